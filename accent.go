@@ -0,0 +1,67 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"github.com/loig/grac/sound"
+)
+
+var accentNames []string = []string{
+	"aucune",
+	"cellules qui changent d'état",
+	"voisines actives",
+	"position dans le cycle",
+}
+
+// cycleAccent replaces the accent by the next one.
+func (gD *GameDisplay) cycleAccent() {
+	gD.audio.accent = (gD.audio.accent + 1) % sound.Accent(len(accentNames))
+}
+
+// stepVelocities returns the velocities of the cells at the current
+// generation of the automaton.
+func (gD *GameDisplay) stepVelocities(step int) []float64 {
+	if gD.audio.accent == sound.NoAccent {
+		return nil
+	}
+	var previous []int
+	if step > 0 {
+		previous = gD.automaton.LastGrid()
+	}
+	cyclePos, period := 0, 0
+	transient, p, found := gD.automaton.Cycle()
+	if generation := gD.automaton.Generation(); found && generation >= transient {
+		cyclePos, period = (generation-transient)%p, p
+	}
+	return gD.audio.accent.Velocities(gD.automaton.Grid(), previous, gD.automaton.Neighbors, cyclePos, period)
+}
+
+// exportedVelocities returns the velocities of the cells of the
+// generations given by exportedGenerations.
+func (gD *GameDisplay) exportedVelocities(generations [][]int) [][]float64 {
+	if gD.audio.accent == sound.NoAccent {
+		return nil
+	}
+	var transient, period int
+	if gD.loop != nil {
+		transient, period = gD.loop.BarsIntro(stepsPerBar, gD.loopIntro), len(gD.loop.Cycle)
+	} else {
+		transient, period, _ = gD.automaton.FindCycle(len(generations))
+	}
+	return gD.audio.accent.AllVelocities(generations, gD.automaton.Neighbors, transient, period)
+}
@@ -0,0 +1,377 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package automaton implements the one-dimensional cellular automata
+// used by GRAC to generate rhythms. It does not depend on any user
+// interface and can be driven from any Go program.
+package automaton
+
+import (
+	"fmt"
+	"math/big"
+)
+
+const (
+	MinSize       = 3
+	DefaultSize   = 25
+	MaxSize       = 40
+	MinNumVal     = 2
+	DefaultNumVal = 2
+	MaxNumVal     = 5
+	MinRadius     = 1
+	DefaultRadius = 1
+	// MaxRadius is the largest radius of the neighborhoods, radii larger
+	// than 1 are only available with 2 states.
+	MaxRadius = 3
+	// ScoreLength is the number of generations, starting from the
+	// current one, that are precomputed in the score.
+	ScoreLength = 35
+	// maxNumRules is the largest number of rules, for 2 states and
+	// MaxRadius, greater than MaxNumVal^3.
+	maxNumRules = 1 << (2*MaxRadius + 1)
+)
+
+// CelAut is a one-dimensional cellular automaton, on a ring of cells
+// unless other boundary conditions are set. Each cell takes a state
+// between 0 and NumVal()-1 and its next state is given by the rules,
+// according to their family.
+type CelAut struct {
+	size          int
+	numVal        int
+	initialGrid   []int
+	lastGrid      []int
+	grid          []int
+	nextGrid      []int
+	score         [][]int
+	family        RuleFamily
+	radius        int
+	rules         []int
+	boundary      Boundary
+	boundaryValue int
+	generation    int
+	visited       map[string]int
+	transient     int
+	period        int
+	cycleFound    bool
+}
+
+// New returns an automaton with default size and number of states,
+// all cells at 0 and all rules leading to 0.
+func New() *CelAut {
+	cA := &CelAut{
+		size:        DefaultSize,
+		numVal:      DefaultNumVal,
+		initialGrid: make([]int, DefaultSize, MaxSize),
+		lastGrid:    make([]int, DefaultSize, MaxSize),
+		grid:        make([]int, DefaultSize, MaxSize),
+		nextGrid:    make([]int, DefaultSize, MaxSize),
+		score:       make([][]int, ScoreLength),
+		rules: make([]int,
+			NumRules(Table, DefaultNumVal, DefaultRadius),
+			maxNumRules),
+		radius: DefaultRadius,
+	}
+	for i := range cA.score {
+		cA.score[i] = make([]int, DefaultSize, MaxSize)
+	}
+	cA.Init()
+	return cA
+}
+
+// Size returns the number of cells of the automaton.
+func (cA *CelAut) Size() int {
+	return cA.size
+}
+
+// SetSize changes the number of cells of the automaton, within
+// MinSize and MaxSize, and puts it back to generation 0. Cells added
+// back after removing them get their previous initial state.
+func (cA *CelAut) SetSize(size int) {
+	if size < MinSize {
+		size = MinSize
+	}
+	if size > MaxSize {
+		size = MaxSize
+	}
+	cA.size = size
+	cA.initialGrid = cA.initialGrid[:size]
+	cA.lastGrid = cA.lastGrid[:size]
+	cA.grid = cA.grid[:size]
+	cA.nextGrid = cA.nextGrid[:size]
+	for i := range cA.score {
+		cA.score[i] = cA.score[i][:size]
+	}
+	cA.Init()
+}
+
+// NumVal returns the number of states a cell can take.
+func (cA *CelAut) NumVal() int {
+	return cA.numVal
+}
+
+// SetNumVal changes the number of states of the cells, within
+// MinNumVal and MaxNumVal, and puts the automaton back to generation 0.
+// With more than 2 states the radius goes back to 1. The rules are
+// converted by ConvertRules and the cells in states that no longer
+// exist go to 0.
+func (cA *CelAut) SetNumVal(numVal int) {
+	if numVal < MinNumVal {
+		numVal = MinNumVal
+	}
+	if numVal > MaxNumVal {
+		numVal = MaxNumVal
+	}
+	radius := cA.radius
+	if numVal > 2 {
+		radius = 1
+	}
+	cA.reshape(numVal, radius)
+}
+
+// Radius returns the number of neighbors on each side of a cell that
+// are used by the rules.
+func (cA *CelAut) Radius() int {
+	return cA.radius
+}
+
+// SetRadius changes the radius of the neighborhoods, within MinRadius
+// and MaxRadius, and puts the automaton back to generation 0. With more
+// than 2 states the radius stays 1. The rules are converted by
+// ConvertRules.
+func (cA *CelAut) SetRadius(radius int) {
+	if radius < MinRadius || cA.numVal > 2 {
+		radius = MinRadius
+	}
+	if radius > MaxRadius {
+		radius = MaxRadius
+	}
+	cA.reshape(cA.numVal, radius)
+}
+
+// reshape changes the number of states and the radius, converts the
+// rules and, as ConvertRules, puts the automaton back to generation 0.
+func (cA *CelAut) reshape(numVal, radius int) {
+	oldRules := cloneLine(cA.rules)
+	oldNumVal, oldRadius := cA.numVal, cA.radius
+	cA.numVal = numVal
+	cA.radius = radius
+	cA.rules = cA.rules[:NumRules(cA.family, numVal, radius)]
+	cA.ConvertRules(oldRules, oldNumVal, oldRadius)
+}
+
+// Generation returns the number of steps since the last call to Init.
+func (cA *CelAut) Generation() int {
+	return cA.generation
+}
+
+// InitialGrid returns the states of the cells at generation 0.
+// The returned slice must not be modified, use SetInitialCell instead.
+func (cA *CelAut) InitialGrid() []int {
+	return cA.initialGrid
+}
+
+// Grid returns the current states of the cells.
+// The returned slice must not be modified.
+func (cA *CelAut) Grid() []int {
+	return cA.grid
+}
+
+// LastGrid returns the states of the cells at the previous generation.
+// The returned slice must not be modified.
+func (cA *CelAut) LastGrid() []int {
+	return cA.lastGrid
+}
+
+// NextGrid returns the states of the cells at the next generation.
+// The returned slice must not be modified.
+func (cA *CelAut) NextGrid() []int {
+	return cA.nextGrid
+}
+
+// Score returns the ScoreLength generations starting from the current
+// one. The returned slices must not be modified.
+func (cA *CelAut) Score() [][]int {
+	return cA.score
+}
+
+// Rules returns the rules of the automaton: the next state of a cell
+// for each neighborhood, see RuleFamily. The returned slice must not be modified, use
+// SetRule instead.
+func (cA *CelAut) Rules() []int {
+	return cA.rules
+}
+
+// SetRule sets the next state of a cell for neighborhood ruleNum, and
+// puts the automaton back to generation 0. The state is taken modulo
+// the number of states.
+func (cA *CelAut) SetRule(ruleNum, state int) {
+	cA.rules[ruleNum] = cA.modState(state)
+	cA.Init()
+}
+
+// modState returns state modulo the number of states, between 0 and
+// NumVal()-1 even for a negative state.
+func (cA *CelAut) modState(state int) int {
+	return (state%cA.numVal + cA.numVal) % cA.numVal
+}
+
+// RuleCode returns the number of the rules: the sum of rules[i]*k^i
+// where k is the number of states. With 2 states this is the usual
+// Wolfram code, e.g. 30 or 110.
+func (cA *CelAut) RuleCode() *big.Int {
+	code := new(big.Int)
+	base := big.NewInt(int64(cA.numVal))
+	for i := len(cA.rules) - 1; i >= 0; i-- {
+		code.Mul(code, base)
+		code.Add(code, big.NewInt(int64(cA.rules[i])))
+	}
+	return code
+}
+
+// SetRuleCode sets the rules from their number, as given by RuleCode,
+// and puts the automaton back to generation 0.
+func (cA *CelAut) SetRuleCode(code *big.Int) error {
+	if code.Sign() < 0 {
+		return fmt.Errorf("automaton: negative rule code %v", code)
+	}
+	n := new(big.Int).Set(code)
+	base := big.NewInt(int64(cA.numVal))
+	digit := new(big.Int)
+	rules := make([]int, len(cA.rules))
+	for i := range rules {
+		n.DivMod(n, base, digit)
+		rules[i] = int(digit.Int64())
+	}
+	if n.Sign() != 0 {
+		return fmt.Errorf("automaton: rule code %v too large for %d states", code, cA.numVal)
+	}
+	copy(cA.rules, rules)
+	cA.Init()
+	return nil
+}
+
+// SetInitialCell sets the state of cell pos at generation 0, and puts
+// the automaton back to generation 0. The state is taken modulo the
+// number of states.
+func (cA *CelAut) SetInitialCell(pos, state int) {
+	cA.initialGrid[pos] = cA.modState(state)
+	cA.Init()
+}
+
+// Init puts the automaton back to generation 0 and computes its score.
+func (cA *CelAut) Init() {
+	cA.generation = 0
+	if cA.boundaryValue >= cA.numVal {
+		cA.boundaryValue = 0
+	}
+	for i := 0; i < len(cA.grid); i++ {
+		if cA.initialGrid[i] >= cA.numVal {
+			cA.initialGrid[i] = 0
+		}
+		cA.grid[i] = cA.initialGrid[i]
+		cA.lastGrid[i] = 0
+	}
+	cA.getNextGrid()
+	cA.getScore()
+	cA.resetCycle()
+}
+
+// Update computes the next generation of the automaton.
+func (cA *CelAut) Update() {
+	cA.generation++
+	copy(cA.lastGrid, cA.grid)
+	copy(cA.grid, cA.nextGrid)
+	cA.getNextGrid()
+	cA.updateScore()
+	cA.visitGrid()
+}
+
+// nextLine computes in next the generation following line.
+func (cA *CelAut) nextLine(line, next []int) {
+	var buf [2*MaxRadius + 1]int
+	cells := buf[:2*cA.radius+1]
+	for i := 0; i < len(next); i++ {
+		for j := range cells {
+			cells[j] = cA.cellAt(line, i+j-cA.radius)
+		}
+		next[i] = cA.rules[neighborhoodIndex(cA.family, cA.numVal, cells)]
+	}
+}
+
+func (cA *CelAut) getNextGrid() {
+	cA.nextLine(cA.grid, cA.nextGrid)
+}
+
+func (cA *CelAut) getScore() {
+	copy(cA.score[0], cA.initialGrid)
+	for i := 1; i < len(cA.score); i++ {
+		cA.nextLine(cA.score[i-1], cA.score[i])
+	}
+}
+
+func (cA *CelAut) updateScore() {
+	for i := 0; i < len(cA.score)-1; i++ {
+		for j := 0; j < len(cA.score[0]); j++ {
+			cA.score[i][j] = cA.score[i+1][j]
+		}
+	}
+	i := len(cA.score) - 1
+	cA.nextLine(cA.score[i-1], cA.score[i])
+}
+
+// Clone returns an independent copy of the automaton.
+func (cA *CelAut) Clone() *CelAut {
+	clone := *cA
+	clone.initialGrid = cloneLine(cA.initialGrid)
+	clone.lastGrid = cloneLine(cA.lastGrid)
+	clone.grid = cloneLine(cA.grid)
+	clone.nextGrid = cloneLine(cA.nextGrid)
+	clone.rules = cloneLine(cA.rules)
+	clone.score = make([][]int, len(cA.score))
+	for i := range cA.score {
+		clone.score[i] = cloneLine(cA.score[i])
+	}
+	if cA.visited != nil {
+		clone.visited = make(map[string]int, len(cA.visited))
+		for key, generation := range cA.visited {
+			clone.visited[key] = generation
+		}
+	}
+	return &clone
+}
+
+func cloneLine(line []int) []int {
+	res := make([]int, len(line), cap(line))
+	copy(res, line)
+	return res
+}
+
+// Generations returns generations 0 to n of the automaton, starting
+// from its initial grid. The automaton itself is not modified.
+func (cA *CelAut) Generations(n int) [][]int {
+	clone := cA.Clone()
+	clone.Init()
+	res := make([][]int, n+1)
+	for i := range res {
+		if i > 0 {
+			clone.Update()
+		}
+		res[i] = cloneLine(clone.grid)
+	}
+	return res
+}
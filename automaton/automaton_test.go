@@ -0,0 +1,204 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+import (
+	"math/big"
+	"testing"
+)
+
+func line(grid []int) string {
+	res := make([]byte, len(grid))
+	for i, state := range grid {
+		res[i] = byte('0' + state)
+	}
+	return string(res)
+}
+
+// elementary returns an automaton with 2 states, the given Wolfram code
+// and the given initial grid.
+func elementary(t *testing.T, code int64, initial string) *CelAut {
+	cA := New()
+	cA.SetSize(len(initial))
+	if err := cA.SetRuleCode(big.NewInt(code)); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range initial {
+		cA.SetInitialCell(i, int(c-'0'))
+	}
+	return cA
+}
+
+func TestGenerations(t *testing.T) {
+	tests := []struct {
+		code int64
+		want []string
+	}{
+		{30, []string{"00000100000", "00001110000", "00011001000", "00110111100", "01100100010"}},
+		{110, []string{"00000100000", "00001100000", "00011100000", "00110100000", "01111100000"}},
+	}
+	for _, test := range tests {
+		cA := elementary(t, test.code, test.want[0])
+		for i, grid := range cA.Generations(len(test.want) - 1) {
+			if line(grid) != test.want[i] {
+				t.Errorf("rule %d, generation %d: got %s, want %s", test.code, i, line(grid), test.want[i])
+			}
+		}
+		for i := 1; i < len(test.want); i++ {
+			cA.Update()
+			if line(cA.Grid()) != test.want[i] {
+				t.Errorf("rule %d, Update %d: got %s, want %s", test.code, i, line(cA.Grid()), test.want[i])
+			}
+		}
+	}
+}
+
+func TestRuleCode(t *testing.T) {
+	for _, numVal := range []int{2, 3, 5} {
+		cA := New()
+		cA.SetNumVal(numVal)
+		for i := range cA.Rules() {
+			cA.SetRule(i, i*7+1)
+		}
+		code := cA.RuleCode()
+		rules := append([]int(nil), cA.Rules()...)
+		other := New()
+		other.SetNumVal(numVal)
+		if err := other.SetRuleCode(code); err != nil {
+			t.Fatal(err)
+		}
+		if line(other.Rules()) != line(rules) {
+			t.Errorf("%d states: rules %s from code %v instead of %s", numVal, line(other.Rules()), code, line(rules))
+		}
+		if other.RuleCode().Cmp(code) != 0 {
+			t.Errorf("%d states: code %v instead of %v", numVal, other.RuleCode(), code)
+		}
+	}
+	cA := elementary(t, 110, "0010")
+	if line(cA.Rules()) != "01110110" {
+		t.Errorf("rule 110 is %s", line(cA.Rules()))
+	}
+	if err := cA.SetRuleCode(big.NewInt(256)); err == nil {
+		t.Error("rule 256 accepted with 2 states")
+	}
+	if err := cA.SetRuleCode(big.NewInt(-1)); err == nil {
+		t.Error("negative rule accepted")
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		code              int64
+		initial           string
+		transient, period int
+	}{
+		{0, "00000", 0, 1},
+		{0, "00100", 1, 1},
+		{204, "01101", 0, 1},
+		{170, "00100", 0, 5},
+		{90, "00010000", 4, 1},
+	}
+	for _, test := range tests {
+		cA := elementary(t, test.code, test.initial)
+		transient, period, found := cA.FindCycle(100)
+		if !found || transient != test.transient || period != test.period {
+			t.Errorf("rule %d from %s: got %d, %d, %v, want %d, %d", test.code, test.initial, transient, period, found, test.transient, test.period)
+		}
+	}
+}
+
+func TestNegativeStates(t *testing.T) {
+	cA := New()
+	cA.SetNumVal(3)
+	cA.SetRule(0, -1)
+	cA.SetInitialCell(0, -4)
+	if cA.Rules()[0] != 2 || cA.InitialGrid()[0] != 2 {
+		t.Errorf("got rule %d and cell %d, want 2 and 2", cA.Rules()[0], cA.InitialGrid()[0])
+	}
+	cA.Init()
+	cA.Update()
+}
+
+func TestSettersApplyAtOnce(t *testing.T) {
+	cA := New()
+	cA.SetSize(10)
+	if len(cA.Grid()) != 10 || len(cA.InitialGrid()) != 10 || len(cA.NextGrid()) != 10 || len(cA.Score()[0]) != 10 {
+		t.Errorf("grids of %d, %d, %d and %d cells after SetSize(10)", len(cA.Grid()), len(cA.InitialGrid()), len(cA.NextGrid()), len(cA.Score()[0]))
+	}
+	cA.SetNumVal(3)
+	if len(cA.Rules()) != 27 {
+		t.Errorf("%d rules with 3 states", len(cA.Rules()))
+	}
+	for i := range cA.Rules() {
+		cA.SetRule(i, 2)
+	}
+	cA.SetInitialCell(0, 2)
+	cA.Update()
+	cA.SetNumVal(2)
+	for i, state := range cA.Rules() {
+		if state != 0 {
+			t.Errorf("rule %d leads to state %d after going back to 2 states", i, state)
+		}
+	}
+	if cA.InitialGrid()[0] != 0 || cA.Generation() != 0 {
+		t.Errorf("cell 0 in state %d at generation %d after going back to 2 states", cA.InitialGrid()[0], cA.Generation())
+	}
+	cA.Update()
+}
+
+// The setters put the automaton back to generation 0 by themselves, so
+// that Update and Score are right without a call to Init.
+func TestSettersWithoutInit(t *testing.T) {
+	cA := New()
+	cA.SetSize(11)
+	if err := cA.SetRuleCode(big.NewInt(30)); err != nil {
+		t.Fatal(err)
+	}
+	cA.SetInitialCell(5, 1)
+	cA.Update()
+	if line(cA.Grid()) != "00001110000" {
+		t.Errorf("got %s after SetRuleCode and SetInitialCell, want 00001110000", line(cA.Grid()))
+	}
+	cA.SetRule(4, 0)
+	cA.Update()
+	if line(cA.Grid()) != "00001100000" {
+		t.Errorf("got %s after SetRule, want 00001100000", line(cA.Grid()))
+	}
+
+	// the outer neighbors of the first and last cells are 1 with a fixed
+	// boundary
+	cA.SetInitialCell(5, 0)
+	cA.SetRule(4, 1)
+	cA.SetBoundary(Fixed)
+	cA.SetBoundaryValue(1)
+	if got := line(cA.Score()[1]); got != "10000000001" {
+		t.Errorf("score %s with a fixed boundary, want 10000000001", got)
+	}
+	cA.SetBoundary(Null)
+	if got := line(cA.Score()[1]); got != "00000000000" {
+		t.Errorf("score %s with a null boundary, want 00000000000", got)
+	}
+
+	cA.SetFamily(Totalistic)
+	cA.SetInitialCell(5, 1)
+	cA.SetRule(1, 1)
+	cA.Update()
+	if line(cA.Grid()) != "00001110000" {
+		t.Errorf("got %s after SetFamily, want 00001110000", line(cA.Grid()))
+	}
+}
@@ -0,0 +1,117 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+import "fmt"
+
+// Boundary tells which states are seen beyond the first and the last
+// cells of the grid.
+type Boundary int
+
+const (
+	// Periodic boundaries put the cells on a ring: the first cell is the
+	// right neighbor of the last one.
+	Periodic Boundary = iota
+	// Fixed boundaries surround the grid with cells in state
+	// BoundaryValue().
+	Fixed
+	// Reflecting boundaries mirror the grid: the cell before the first
+	// one is the first one, the cell before it is the second one, etc.
+	Reflecting
+	// Null boundaries surround the grid with cells in state 0.
+	Null
+)
+
+var boundaryNames []string = []string{"periodic", "fixed", "reflecting", "null"}
+
+func (b Boundary) String() string {
+	if b < 0 || int(b) >= len(boundaryNames) {
+		return fmt.Sprint("Boundary(", int(b), ")")
+	}
+	return boundaryNames[b]
+}
+
+// ParseBoundary returns the boundary with the given name, as given by
+// Boundary.String.
+func ParseBoundary(name string) (Boundary, error) {
+	for i, boundaryName := range boundaryNames {
+		if name == boundaryName {
+			return Boundary(i), nil
+		}
+	}
+	return Periodic, fmt.Errorf("automaton: unknown boundary %q", name)
+}
+
+// Boundary returns the boundary conditions of the automaton.
+func (cA *CelAut) Boundary() Boundary {
+	return cA.boundary
+}
+
+// SetBoundary changes the boundary conditions of the automaton, and
+// puts it back to generation 0.
+func (cA *CelAut) SetBoundary(b Boundary) {
+	cA.boundary = b
+	cA.Init()
+}
+
+// BoundaryValue returns the state of the cells beyond the grid with
+// Fixed boundaries.
+func (cA *CelAut) BoundaryValue() int {
+	return cA.boundaryValue
+}
+
+// SetBoundaryValue sets the state of the cells beyond the grid with
+// Fixed boundaries, and puts the automaton back to generation 0. The
+// state is taken modulo the number of states.
+func (cA *CelAut) SetBoundaryValue(state int) {
+	cA.boundaryValue = cA.modState(state)
+	cA.Init()
+}
+
+// cellAt returns the state of cell i of line, i being possibly outside
+// of the grid by at most its length.
+func (cA *CelAut) cellAt(line []int, i int) int {
+	if i >= 0 && i < len(line) {
+		return line[i]
+	}
+	switch cA.boundary {
+	case Fixed:
+		return cA.boundaryValue
+	case Reflecting:
+		if i < 0 {
+			return line[-i-1]
+		}
+		return line[2*len(line)-i-1]
+	case Null:
+		return 0
+	}
+	return line[(i+len(line))%len(line)]
+}
+
+// Neighbors returns the states of the neighbors of cell i in line, a
+// generation of the automaton, from left to right and without the cell
+// itself, according to the radius and the boundary conditions.
+func (cA *CelAut) Neighbors(line []int, i int) []int {
+	res := make([]int, 0, 2*cA.radius)
+	for j := i - cA.radius; j <= i+cA.radius; j++ {
+		if j != i {
+			res = append(res, cA.cellAt(line, j))
+		}
+	}
+	return res
+}
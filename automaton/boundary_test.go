@@ -0,0 +1,66 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+import "testing"
+
+func TestFixedBoundary(t *testing.T) {
+	cA := New()
+	cA.SetNumVal(3)
+	cA.SetSize(5)
+	cA.SetBoundary(Fixed)
+	cA.SetBoundaryValue(-1)
+	if cA.BoundaryValue() != 2 {
+		t.Fatalf("boundary in state %d after SetBoundaryValue(-1), want 2", cA.BoundaryValue())
+	}
+	// each cell takes the state of its left neighbor
+	for i := range cA.Rules() {
+		cA.SetRule(i, i/9)
+	}
+	cA.Init()
+	cA.Update()
+	if line(cA.Grid()) != "20000" {
+		t.Errorf("got %s, want 20000", line(cA.Grid()))
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	tests := []struct {
+		boundary Boundary
+		radius   int
+		want     string
+	}{
+		{Periodic, 1, "52"},
+		{Null, 1, "02"},
+		{Fixed, 1, "12"},
+		{Reflecting, 2, "2123"},
+		{Periodic, 3, "345234"},
+	}
+	// Neighbors only reads the states, which show here the positions
+	grid := []int{1, 2, 3, 4, 5}
+	for _, test := range tests {
+		cA := New()
+		cA.SetSize(len(grid))
+		cA.SetRadius(test.radius)
+		cA.SetBoundary(test.boundary)
+		cA.SetBoundaryValue(1)
+		if got := line(cA.Neighbors(grid, 0)); got != test.want {
+			t.Errorf("%v, radius %d: got %s, want %s", test.boundary, test.radius, got, test.want)
+		}
+	}
+}
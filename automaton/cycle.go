@@ -0,0 +1,68 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+// maxVisited is the number of grids remembered to detect cycles, after
+// which cycles are not searched anymore.
+const maxVisited = 1 << 20
+
+// Cycle returns, once the automaton came back to a grid it already
+// visited since the last call to Init, the number of generations before
+// entering the cycle and the length of the cycle.
+func (cA *CelAut) Cycle() (transient, period int, found bool) {
+	return cA.transient, cA.period, cA.cycleFound
+}
+
+// FindCycle runs a copy of the automaton from its initial grid for at
+// most maxSteps generations and returns its cycle, as given by Cycle.
+func (cA *CelAut) FindCycle(maxSteps int) (transient, period int, found bool) {
+	clone := cA.Clone()
+	clone.Init()
+	for i := 0; i < maxSteps && !clone.cycleFound; i++ {
+		clone.Update()
+	}
+	return clone.Cycle()
+}
+
+func (cA *CelAut) resetCycle() {
+	cA.visited = make(map[string]int)
+	cA.transient = 0
+	cA.period = 0
+	cA.cycleFound = false
+	cA.visitGrid()
+}
+
+// visitGrid remembers the current grid, or finds the cycle if it was
+// already visited.
+func (cA *CelAut) visitGrid() {
+	if cA.cycleFound || cA.visited == nil || len(cA.visited) >= maxVisited {
+		return
+	}
+	key := make([]byte, len(cA.grid))
+	for i, state := range cA.grid {
+		key[i] = byte(state)
+	}
+	if generation, ok := cA.visited[string(key)]; ok {
+		cA.transient = generation
+		cA.period = cA.generation - generation
+		cA.cycleFound = true
+		cA.visited = nil
+		return
+	}
+	cA.visited[string(key)] = cA.generation
+}
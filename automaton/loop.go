@@ -0,0 +1,77 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+// Loop is the periodic part of the run of an automaton from its initial
+// grid, with the generations leading to it.
+type Loop struct {
+	// Intro holds the generations before the cycle.
+	Intro [][]int
+	// Cycle holds one period of the cycle.
+	Cycle [][]int
+}
+
+// FindLoop runs a copy of the automaton from its initial grid for at
+// most maxSteps generations and returns its loop, if a cycle was found.
+func (cA *CelAut) FindLoop(maxSteps int) (*Loop, bool) {
+	transient, period, found := cA.FindCycle(maxSteps)
+	if !found {
+		return nil, false
+	}
+	generations := cA.Generations(transient + period - 1)
+	return &Loop{
+		Intro: generations[:transient],
+		Cycle: generations[transient:],
+	}, true
+}
+
+// Bars returns the cycle repeated to fill a whole number of bars of
+// stepsPerBar steps. With intro, the cycle is preceded by the intro,
+// itself preceded by empty grids so that the cycle starts on a bar.
+func (l *Loop) Bars(stepsPerBar int, intro bool) [][]int {
+	var res [][]int
+	if intro && len(l.Intro) > 0 {
+		numCells := len(l.Intro[0])
+		for i := 0; i < (stepsPerBar-len(l.Intro)%stepsPerBar)%stepsPerBar; i++ {
+			res = append(res, make([]int, numCells))
+		}
+		res = append(res, l.Intro...)
+	}
+	period := len(l.Cycle)
+	repeat := stepsPerBar / gcd(period, stepsPerBar)
+	for i := 0; i < repeat; i++ {
+		res = append(res, l.Cycle...)
+	}
+	return res
+}
+
+// BarsIntro returns the number of grids before the first repetition of
+// the cycle in the result of Bars.
+func (l *Loop) BarsIntro(stepsPerBar int, intro bool) int {
+	if !intro || len(l.Intro) == 0 {
+		return 0
+	}
+	return len(l.Intro) + (stepsPerBar-len(l.Intro)%stepsPerBar)%stepsPerBar
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,182 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+import "fmt"
+
+// RuleFamily tells how the next state of a cell is obtained from its
+// neighborhood.
+type RuleFamily int
+
+const (
+	// Table rules give the next state for each neighborhood, indexed by
+	// the states of its cells read as a number in base k for k states,
+	// e.g. left*k^2+mid*k+right for radius 1.
+	Table RuleFamily = iota
+	// Totalistic rules give the next state for each sum of the states of
+	// the neighborhood.
+	Totalistic
+	// OuterTotalistic rules give the next state for each state of the
+	// cell and each sum of the states of its neighbors, indexed by
+	// mid*(2r(k-1)+1)+sum for k states and radius r.
+	OuterTotalistic
+)
+
+var familyNames []string = []string{"table", "totalistic", "outer-totalistic"}
+
+func (f RuleFamily) String() string {
+	if f < 0 || int(f) >= len(familyNames) {
+		return fmt.Sprint("RuleFamily(", int(f), ")")
+	}
+	return familyNames[f]
+}
+
+// ParseRuleFamily returns the family with the given name, as given by
+// RuleFamily.String.
+func ParseRuleFamily(name string) (RuleFamily, error) {
+	for i, familyName := range familyNames {
+		if name == familyName {
+			return RuleFamily(i), nil
+		}
+	}
+	return Table, fmt.Errorf("automaton: unknown rule family %q", name)
+}
+
+// NumRules returns the number of rules of family f for numVal states
+// and neighborhoods of the given radius.
+func NumRules(f RuleFamily, numVal, radius int) int {
+	n := 2*radius + 1
+	switch f {
+	case Totalistic:
+		return n*(numVal-1) + 1
+	case OuterTotalistic:
+		return numVal * ((n-1)*(numVal-1) + 1)
+	}
+	res := 1
+	for i := 0; i < n; i++ {
+		res *= numVal
+	}
+	return res
+}
+
+// neighborhoodIndex returns the position of the rule to apply to the
+// states of a neighborhood, for family f and numVal states.
+func neighborhoodIndex(f RuleFamily, numVal int, cells []int) int {
+	n := len(cells)
+	mid := cells[n/2]
+	sum := 0
+	for _, state := range cells {
+		sum += state
+	}
+	switch f {
+	case Totalistic:
+		return sum
+	case OuterTotalistic:
+		return mid*((n-1)*(numVal-1)+1) + sum - mid
+	}
+	index := 0
+	for _, state := range cells {
+		index = index*numVal + state
+	}
+	return index
+}
+
+// tableNeighborhood returns the states of the n cells of the
+// neighborhood of the Table rule at position i.
+func tableNeighborhood(i, numVal, n int) []int {
+	cells := make([]int, n)
+	for j := n - 1; j >= 0; j-- {
+		cells[j] = i % numVal
+		i /= numVal
+	}
+	return cells
+}
+
+// ConvertRules sets the rules from rules, given for the same family
+// with oldNumVal states and radius oldRadius, and puts the automaton
+// back to generation 0. The neighborhoods that already existed keep
+// their next state, when this state still exists, and the other ones
+// lead to 0.
+func (cA *CelAut) ConvertRules(rules []int, oldNumVal, oldRadius int) {
+	for i := range cA.rules {
+		cA.rules[i] = 0
+		if oldPos, ok := cA.previousRulePos(i, oldNumVal, oldRadius); ok && oldPos < len(rules) && rules[oldPos] < cA.numVal {
+			cA.rules[i] = rules[oldPos]
+		}
+	}
+	cA.Init()
+}
+
+// previousRulePos returns the position of the rule at position i among
+// the rules for oldNumVal states and radius oldRadius, if this rule
+// existed there. When the radius grows, the new cells of the
+// neighborhood are ignored, when it shrinks, the old ones are taken at 0.
+func (cA *CelAut) previousRulePos(i, oldNumVal, oldRadius int) (int, bool) {
+	numVal := cA.numVal
+	n := 2*cA.radius + 1
+	oldN := 2*oldRadius + 1
+	switch cA.family {
+	case Totalistic:
+		return i, i <= oldN*(oldNumVal-1)
+	case OuterTotalistic:
+		mid := i / ((n-1)*(numVal-1) + 1)
+		sum := i % ((n-1)*(numVal-1) + 1)
+		return mid*((oldN-1)*(oldNumVal-1)+1) + sum, mid < oldNumVal && sum <= (oldN-1)*(oldNumVal-1)
+	}
+	cells := tableNeighborhood(i, numVal, n)
+	oldPos := 0
+	for j := n/2 - oldN/2; j <= n/2+oldN/2; j++ {
+		state := 0
+		if j >= 0 && j < n {
+			state = cells[j]
+		}
+		if state >= oldNumVal {
+			return 0, false
+		}
+		oldPos = oldPos*oldNumVal + state
+	}
+	return oldPos, true
+}
+
+// Family returns the family of the rules.
+func (cA *CelAut) Family() RuleFamily {
+	return cA.family
+}
+
+// SetFamily changes the family of the rules, and puts the automaton
+// back to generation 0. When changing to Table the automaton keeps the
+// same behavior, otherwise all the rules lead to 0.
+func (cA *CelAut) SetFamily(f RuleFamily) {
+	if f == cA.family {
+		return
+	}
+	oldFamily := cA.family
+	oldRules := cloneLine(cA.rules)
+	numVal := cA.numVal
+	n := 2*cA.radius + 1
+	cA.family = f
+	cA.rules = cA.rules[:NumRules(f, numVal, cA.radius)]
+	for i := range cA.rules {
+		cA.rules[i] = 0
+		if f == Table {
+			cells := tableNeighborhood(i, numVal, n)
+			cA.rules[i] = oldRules[neighborhoodIndex(oldFamily, numVal, cells)]
+		}
+	}
+	cA.Init()
+}
@@ -0,0 +1,90 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package automaton
+
+import "testing"
+
+// Going to fewer states and a larger radius, in the order of the
+// graphical interface which converts the rules it kept before the first
+// change, must not keep rules leading to states that no longer exist.
+func TestConvertRulesNewNeighborhoods(t *testing.T) {
+	for _, family := range []RuleFamily{Table, Totalistic, OuterTotalistic} {
+		cA := New()
+		cA.SetNumVal(3)
+		cA.SetFamily(family)
+		for i := range cA.Rules() {
+			cA.SetRule(i, 2)
+		}
+		saved := append([]int(nil), cA.Rules()...)
+		cA.SetNumVal(2)
+		cA.ConvertRules(saved, 3, 1)
+		for radius := 2; radius <= MaxRadius; radius++ {
+			cA.SetRadius(radius)
+			cA.ConvertRules(saved, 3, 1)
+		}
+		for i, state := range cA.Rules() {
+			if state >= cA.NumVal() {
+				t.Fatalf("%v: rule %d leads to state %d with %d states", family, i, state, cA.NumVal())
+			}
+		}
+		for i := 0; i < 2*MaxRadius+1; i++ {
+			cA.SetInitialCell(i, 1)
+		}
+		cA.Init()
+		cA.Update()
+	}
+}
+
+func TestConvertRulesBack(t *testing.T) {
+	for _, family := range []RuleFamily{Table, Totalistic, OuterTotalistic} {
+		cA := New()
+		cA.SetNumVal(3)
+		cA.SetFamily(family)
+		for i := range cA.Rules() {
+			cA.SetRule(i, i)
+		}
+		saved := append([]int(nil), cA.Rules()...)
+		cA.SetNumVal(2)
+		cA.SetNumVal(3)
+		cA.ConvertRules(saved, 3, 1)
+		for i, state := range cA.Rules() {
+			if state != saved[i] {
+				t.Fatalf("%v: rule %d is %d instead of %d", family, i, state, saved[i])
+			}
+		}
+	}
+}
+
+func TestSetFamilyTable(t *testing.T) {
+	cA := New()
+	cA.SetNumVal(3)
+	cA.SetFamily(Totalistic)
+	for i := range cA.Rules() {
+		cA.SetRule(i, i)
+	}
+	cA.SetInitialCell(5, 1)
+	cA.SetInitialCell(6, 2)
+	want := cA.Generations(20)
+	cA.SetFamily(Table)
+	got := cA.Generations(20)
+	for i := range want {
+		if line(got[i]) != line(want[i]) {
+			t.Fatalf("generation %d is %s instead of %s", i, line(got[i]), line(want[i]))
+		}
+	}
+}
@@ -19,192 +19,122 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package main
 
 import (
+	"fmt"
 	"image/color"
 	"math"
 
+	"github.com/loig/grac/automaton"
+	"github.com/loig/grac/sound"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 )
 
-type CelAut struct {
-	size          int
-	numVal        int
-	initialGrid   []int
-	lastGrid      []int
-	grid          []int
-	nextGrid      []int
-	score         [][]int
-	previousRules []int
-	keepOldRules  bool
-	rules         []int
-	generation    int
-}
+// Positions of the automaton and of the rules on the screen.
+const (
+	automatonX = 700
+	automatonY = 300
+	partY      = 20
+	rulesX     = 20
+	rulesY     = 75
+)
 
-func initCellularAutomaton() CelAut {
-	cA := CelAut{
-		size:        globalDefaultSize,
-		numVal:      globalDefaultNumVal,
-		initialGrid: make([]int, globalDefaultSize, globalMaxSize),
-		lastGrid:    make([]int, globalDefaultSize, globalMaxSize),
-		grid:        make([]int, globalDefaultSize, globalMaxSize),
-		nextGrid:    make([]int, globalDefaultSize, globalMaxSize),
-		score:       make([][]int, globalDisplayLine-1),
-		previousRules: make([]int,
-			globalDefaultNumVal*globalDefaultNumVal*globalDefaultNumVal, globalMaxNumVal*globalMaxNumVal*globalMaxNumVal),
-		rules: make([]int,
-			globalDefaultNumVal*globalDefaultNumVal*globalDefaultNumVal,
-			globalMaxNumVal*globalMaxNumVal*globalMaxNumVal),
-	}
-	for i := range cA.score {
-		cA.score[i] = make([]int, globalDefaultSize, globalMaxSize)
-	}
-	return cA
+// partX returns the left of the score of cA on the screen.
+func partX(cA *automaton.CelAut) int {
+	return 350 + (globalMaxSize-cA.Size())*8
 }
 
-func (cA *CelAut) genGrid(fresh bool) {
-	if fresh || cA.size != len(cA.initialGrid) {
-		cA.initialGrid = cA.initialGrid[:cA.size]
-		cA.grid = cA.grid[:cA.size]
-		for i := range cA.score {
-			cA.score[i] = cA.score[i][:cA.size]
-		}
-	}
-	copy(cA.grid, cA.initialGrid)
-	cA.lastGrid = cA.lastGrid[:cA.size]
-	cA.nextGrid = cA.nextGrid[:cA.size]
-	for i := range cA.lastGrid {
-		cA.lastGrid[i] = 0
-		cA.nextGrid[i] = 0
-	}
-	for i := range cA.score {
-		for j := range cA.score[i] {
-			cA.score[i][j] = 0
-		}
-	}
-}
+// highlightColor surrounds the audible cells when only some of them are.
+var highlightColor color.Color = color.RGBA{255, 255, 102, 255}
 
-func (cA *CelAut) genBasicRules(fresh bool) {
-	numRules := cA.numVal * cA.numVal * cA.numVal
-	if fresh {
-		cA.rules = cA.rules[:numRules]
-	} else if numRules != len(cA.rules) {
-		if !cA.keepOldRules {
-			cA.previousRules = cA.previousRules[:len(cA.rules)]
-			copy(cA.previousRules, cA.rules)
-			cA.keepOldRules = true
-		}
-		oldNumVal := 1
-		for oldNumVal*oldNumVal*oldNumVal != len(cA.previousRules) {
-			oldNumVal++
-		}
-		cA.rules = cA.rules[:numRules]
-		for i := 0; i < len(cA.rules); i++ {
-			left := i / (cA.numVal * cA.numVal)
-			mid := (i / cA.numVal) % cA.numVal
-			right := i % cA.numVal
-			if left < oldNumVal && mid < oldNumVal && right < oldNumVal {
-				oldPos := left*oldNumVal*oldNumVal + mid*oldNumVal + right
-				cA.rules[i] = cA.previousRules[oldPos]
-				if cA.rules[i] >= cA.numVal {
-					cA.rules[i] = 0
-				}
-			}
-		}
+func drawAutomaton(cA *automaton.CelAut, window sound.Window, screen *ebiten.Image, x, y int, drawCursor bool, drawFuturAndPast bool) {
+	if cA.Boundary() != automaton.Periodic {
+		drawAutomatonLine(cA, window, screen, float64(x), float64(y), drawCursor, drawFuturAndPast)
+		return
 	}
-}
-
-func (cA *CelAut) init() {
-	cA.generation = 0
-	for i := 0; i < len(cA.grid); i++ {
-		if cA.initialGrid[i] >= cA.numVal {
-			cA.initialGrid[i] = 0
-		}
-		cA.grid[i] = cA.initialGrid[i]
+	for i := 0; i < len(cA.Grid()); i++ {
+		cellX, cellY, scale := cellCenter(cA, i, x, y)
+		drawCell(cA, i, screen, cellX, cellY, scale, drawFuturAndPast, (i == currentCell) && drawCursor, highlighted(window, i))
 	}
-	cA.getNextGrid()
-	cA.getScore()
-}
-
-func (cA *CelAut) update() {
-	cA.generation++
-	copy(cA.lastGrid, cA.grid)
-	copy(cA.grid, cA.nextGrid)
-	cA.getNextGrid()
-	cA.updateScore()
 }
 
-func (cA *CelAut) getNextGrid() {
-	for i := 0; i < len(cA.nextGrid); i++ {
-		left := (i - 1 + len(cA.nextGrid)) % len(cA.grid)
-		mid := i
-		right := (i + 1) % len(cA.grid)
-		ruleNum := cA.grid[left]*cA.numVal*cA.numVal + cA.grid[mid]*cA.numVal + cA.grid[right]
-		cA.nextGrid[i] = cA.rules[ruleNum]
-	}
+// cellCenter returns the center and the scale of cell i when cA is
+// drawn by drawAutomaton at x, y.
+func cellCenter(cA *automaton.CelAut, i, x, y int) (float64, float64, float64) {
+	numCells := len(cA.Grid())
+	if cA.Boundary() != automaton.Periodic {
+		startX, colSize, scale := lineLayout(numCells, float64(x))
+		return startX + float64(i)*colSize, float64(y), scale
+	}
+	radius := float64(7 * numCells)
+	return float64(x) + radius*math.Cos(2*math.Pi*float64(i)/float64(numCells)),
+		float64(y) + radius*math.Sin(2*math.Pi*float64(i)/float64(numCells)), 1
 }
 
-func (cA *CelAut) getScore() {
-	copy(cA.score[0], cA.initialGrid)
-	for i := 1; i < len(cA.score); i++ {
-		for j := 0; j < len(cA.score[i]); j++ {
-			left := (j - 1 + len(cA.score[i])) % len(cA.score[i-1])
-			mid := j
-			right := (j + 1) % len(cA.score[i-1])
-			ruleNum := cA.score[i-1][left]*cA.numVal*cA.numVal + cA.score[i-1][mid]*cA.numVal + cA.score[i-1][right]
-			cA.score[i][j] = cA.rules[ruleNum]
-		}
-	}
+// lineLayout returns the center of the first cell, the distance between
+// cells and their scale when numCells cells are drawn on a line centered
+// on x.
+func lineLayout(numCells int, x float64) (startX, colSize, scale float64) {
+	colSize = math.Min(560/float64(numCells+2), 28)
+	scale = math.Min(1, (colSize-2)/20)
+	return x - float64(numCells-1)/2*colSize, colSize, scale
 }
 
-func (cA *CelAut) updateScore() {
-	for i := 0; i < len(cA.score)-1; i++ {
-		for j := 0; j < len(cA.score[0]); j++ {
-			cA.score[i][j] = cA.score[i+1][j]
+// drawAutomatonLine draws the cells on a line centered on x, y, for
+// automata whose boundaries are not periodic.
+func drawAutomatonLine(cA *automaton.CelAut, window sound.Window, screen *ebiten.Image, x, y float64, drawCursor bool, drawFuturAndPast bool) {
+	numCells := len(cA.Grid())
+	startX, colSize, scale := lineLayout(numCells, x)
+	for i := 0; i < numCells; i++ {
+		drawCell(cA, i, screen, startX+float64(i)*colSize, y, scale, drawFuturAndPast, (i == currentCell) && drawCursor, highlighted(window, i))
+	}
+	barWidth := 2.0
+	barHeight := 40 * scale
+	for _, barX := range []float64{startX - colSize/2, startX + float64(numCells)*colSize - colSize/2} {
+		barColor := color.Color(color.White)
+		if cA.Boundary() == automaton.Fixed {
+			barColor = stateColors[cA.BoundaryValue()]
 		}
-	}
-	i := len(cA.score) - 1
-	for j := 0; j < len(cA.score[i]); j++ {
-		left := (j - 1 + len(cA.score[i])) % len(cA.score[i-1])
-		mid := j
-		right := (j + 1) % len(cA.score[i-1])
-		ruleNum := cA.score[i-1][left]*cA.numVal*cA.numVal + cA.score[i-1][mid]*cA.numVal + cA.score[i-1][right]
-		cA.score[i][j] = cA.rules[ruleNum]
+		ebitenutil.DrawRect(screen, barX-barWidth/2, y-barHeight/2, barWidth, barHeight, barColor)
 	}
 }
 
-func (cA *CelAut) draw(screen *ebiten.Image, x, y int, drawCursor bool, drawFuturAndPast bool) {
-	radius := float64(7 * len(cA.grid))
-	xCenter := float64(x)
-	yCenter := float64(y)
-	for i := 0; i < len(cA.grid); i++ {
-		cellX := xCenter + radius*math.Cos(2*math.Pi*float64(i)/float64(len(cA.grid)))
-		cellY := yCenter + radius*math.Sin(2*math.Pi*float64(i)/float64(len(cA.grid)))
-		cA.drawCell(i, screen, cellX, cellY, drawFuturAndPast, (i == currentCell) && drawCursor)
-	}
+// highlighted tells whether cell is drawn as audible.
+func highlighted(window sound.Window, cell int) bool {
+	return len(window.Cells) > 0 && window.Audible(cell)
 }
 
-func (cA *CelAut) drawPart(screen *ebiten.Image, x, y int, drawCursor bool, drawFuturAndPast bool) {
+func drawPart(cA *automaton.CelAut, window sound.Window, screen *ebiten.Image, x, y int, drawCursor bool, drawFuturAndPast bool) {
 
 	lineSize := 16
 	numLines := globalDisplayLine
 
 	if drawFuturAndPast {
-		if len(cA.lastGrid) > 0 {
-			cA.drawLine(screen, x, y, false, cA.lastGrid, false)
+		if len(cA.LastGrid()) > 0 {
+			drawLine(cA, sound.Window{}, screen, x, y, false, cA.LastGrid(), false)
 		}
 	}
 
-	cA.drawLine(screen, x, y+lineSize, drawCursor, cA.grid, true)
+	drawLine(cA, window, screen, x, y+lineSize, drawCursor, cA.Grid(), true)
 
 	if drawFuturAndPast {
 		for i := 1; i < numLines-1; i++ {
-			cA.drawLine(screen, x, y+(i+1)*lineSize, false, cA.score[i], false)
+			drawLine(cA, sound.Window{}, screen, x, y+(i+1)*lineSize, false, cA.Score()[i], false)
 		}
 	}
 
 }
 
-func (cA *CelAut) drawLine(screen *ebiten.Image, x, y int, drawCursor bool, line []int, current bool) {
+// partCellCenter returns the center of cell i of the current generation
+// when the score of cA is drawn by drawPart at x, y, and the half width
+// of the column of the cell.
+func partCellCenter(cA *automaton.CelAut, i, x, y int) (float64, float64, float64) {
+	lineSize := 16
+	colSize := 16
+	return float64(x + i*colSize), float64(y + lineSize), float64(colSize) / 2
+}
+
+func drawLine(cA *automaton.CelAut, window sound.Window, screen *ebiten.Image, x, y int, drawCursor bool, line []int, current bool) {
 
 	bigSize := 12
 	smallSize := 8
@@ -212,12 +142,15 @@ func (cA *CelAut) drawLine(screen *ebiten.Image, x, y int, drawCursor bool, line
 	cursorSize := 14
 
 	for i := range line {
+		if highlighted(window, i) {
+			ebitenutil.DrawRect(screen, float64(x-colSize/2+i*colSize), float64(y-colSize/2), float64(colSize), float64(colSize), highlightColor)
+		}
 		if drawCursor && i == currentCell {
 			ebitenutil.DrawRect(screen, float64(x-cursorSize/2+i*colSize), float64(y-cursorSize/2), float64(cursorSize), float64(cursorSize), color.White)
 		}
 
 		colorPos := line[i]
-		if colorPos >= cA.numVal {
+		if colorPos >= cA.NumVal() {
 			colorPos = 0
 		}
 		cellColor := stateColors[colorPos]
@@ -230,51 +163,80 @@ func (cA *CelAut) drawLine(screen *ebiten.Image, x, y int, drawCursor bool, line
 
 }
 
-func (cA *CelAut) drawCell(pos int, screen *ebiten.Image, x, y float64, drawOther, drawCursor bool) {
-	smallSize := 5.0
-	bigSize := 20.0
-	cursorSize := 22.0
+func drawCell(cA *automaton.CelAut, pos int, screen *ebiten.Image, x, y, scale float64, drawOther, drawCursor, highlight bool) {
+	smallSize := 5.0 * scale
+	bigSize := 20.0 * scale
+	cursorSize := 22.0 * scale
+	highlightSize := 26.0 * scale
+	if highlight {
+		ebitenutil.DrawRect(screen, x-highlightSize/2, y-highlightSize/2, highlightSize, highlightSize, highlightColor)
+	}
 	if drawCursor {
 		ebitenutil.DrawRect(screen, x-cursorSize/2, y-cursorSize/2, cursorSize, cursorSize, color.White)
 	}
-	colorPos := cA.grid[pos]
-	if colorPos >= cA.numVal {
+	colorPos := cA.Grid()[pos]
+	if colorPos >= cA.NumVal() {
 		colorPos = 0
 	}
 	cellColor := stateColors[colorPos]
 	ebitenutil.DrawRect(screen, x-bigSize/2, y-bigSize/2, bigSize, bigSize, cellColor)
 	if drawOther {
-		lastColor := stateColors[cA.lastGrid[pos]]
-		nextColor := stateColors[cA.nextGrid[pos]]
+		lastColor := stateColors[cA.LastGrid()[pos]]
+		nextColor := stateColors[cA.NextGrid()[pos]]
 		ebitenutil.DrawRect(screen, x-bigSize/2-2, y-bigSize/2-smallSize-1, smallSize, smallSize, lastColor)
 		ebitenutil.DrawRect(screen, x+bigSize/2-smallSize+2, y+bigSize/2+1, smallSize, smallSize, nextColor)
 	}
 }
 
-func (cA *CelAut) drawRules(screen *ebiten.Image, x, y int, drawCursor bool) {
+func drawRules(cA *automaton.CelAut, screen *ebiten.Image, x, y int, drawCursor bool) {
+	for i := 0; i < len(cA.Rules()); i++ {
+		ruleX, ruleY := rulePosition(i, x, y)
+		drawRule(cA, i, screen, ruleX, ruleY, i == currentRule && drawCursor)
+	}
+}
+
+// rulePosition returns the top left corner of rule ruleNum when the
+// rules are drawn by drawRules at x, y.
+func rulePosition(ruleNum, x, y int) (float64, float64) {
 	xOffset := 37
 	yOffset := 26
-	for i := 0; i < len(cA.rules); i++ {
-		cA.drawRule(i, screen, float64(x+(i%8)*xOffset), float64(y+(i/8)*yOffset), i == currentRule && drawCursor)
-	}
+	return float64(x + (ruleNum%8)*xOffset), float64(y + (ruleNum/8)*yOffset)
 }
 
-func (cA *CelAut) drawRule(ruleNum int, screen *ebiten.Image, x, y float64, drawCursor bool) {
-	size := 10.0
+// ruleSize returns the size of the cells of the rules of cA and the
+// width of a rule.
+func ruleSize(cA *automaton.CelAut) (size, width float64) {
+	numCells := 2*cA.Radius() + 1
+	size = float64((34 - (numCells - 1)) / numCells)
+	return size, float64(numCells)*(size+1) - 1
+}
+
+func drawRule(cA *automaton.CelAut, ruleNum int, screen *ebiten.Image, x, y float64, drawCursor bool) {
+	numCells := 2*cA.Radius() + 1
+	size, width := ruleSize(cA)
 	if drawCursor {
-		ebitenutil.DrawRect(screen, x-2, y-2, 3*size+6, 2*size+5, color.White)
-		ebitenutil.DrawRect(screen, x-1, y-1, 3*size+4, 2*size+3, color.Black)
-	}
-	actualNumVal := 1
-	for actualNumVal*actualNumVal*actualNumVal != len(cA.rules) {
-		actualNumVal++
+		ebitenutil.DrawRect(screen, x-2, y-2, width+4, 2*size+5, color.White)
+		ebitenutil.DrawRect(screen, x-1, y-1, width+2, 2*size+3, color.Black)
+	}
+	numVal := cA.NumVal()
+	midX := x + float64(numCells/2)*(size+1)
+	switch cA.Family() {
+	case automaton.Totalistic:
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint(ruleNum), int(midX), int(y)-3)
+	case automaton.OuterTotalistic:
+		numSums := (numCells-1)*(numVal-1) + 1
+		midState := ruleNum / numSums
+		sum := ruleNum % numSums
+		ebitenutil.DrawRect(screen, midX, y, size, size, stateColors[midState])
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("+", sum), int(midX+size+1), int(y)-3)
+	default:
+		neighborhood := ruleNum
+		for i := numCells - 1; i >= 0; i-- {
+			cellState := neighborhood % numVal
+			neighborhood /= numVal
+			ebitenutil.DrawRect(screen, x+float64(i)*(size+1), y, size, size, stateColors[cellState])
+		}
 	}
-	leftState := ruleNum / (actualNumVal * actualNumVal)
-	midState := (ruleNum / (actualNumVal)) % actualNumVal
-	rightState := ruleNum % actualNumVal
-	ebitenutil.DrawRect(screen, x, y, size, size, stateColors[leftState])
-	ebitenutil.DrawRect(screen, x+size+1, y, size, size, stateColors[midState])
-	ebitenutil.DrawRect(screen, x+2*size+2, y, size, size, stateColors[rightState])
-	state := cA.rules[ruleNum]
-	ebitenutil.DrawRect(screen, x+size+1, y+size+1, size, size, stateColors[state])
+	state := cA.Rules()[ruleNum]
+	ebitenutil.DrawRect(screen, midX, y+size+1, size, size, stateColors[state])
 }
@@ -18,6 +18,13 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package main
 
 import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/loig/grac/automaton"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
@@ -25,12 +32,12 @@ import (
 func (gD *GameDisplay) chooseSizeUpdate() bool {
 	switch {
 	case inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyRight):
-		if gD.automaton.size < globalMaxSize {
-			gD.automaton.size++
+		if gD.automaton.Size() < globalMaxSize {
+			gD.automaton.SetSize(gD.automaton.Size() + 1)
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyLeft):
-		if gD.automaton.size > globalMinSize {
-			gD.automaton.size--
+		if gD.automaton.Size() > globalMinSize {
+			gD.automaton.SetSize(gD.automaton.Size() - 1)
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
 		return true
@@ -39,17 +46,37 @@ func (gD *GameDisplay) chooseSizeUpdate() bool {
 }
 
 func (gD *GameDisplay) chooseTempoUpdate() bool {
-	switch {
-	case inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyRight):
-		if gD.tempoPos < len(tempos)-1 {
-			gD.tempoPos++
+	for _, r := range ebiten.InputChars() {
+		if r >= '0' && r <= '9' && len(typedTempo) < 4 {
+			typedTempo += string(r)
 		}
-	case inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyLeft):
-		if gD.tempoPos > 0 {
-			gD.tempoPos--
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		gD.setTempo(math.Floor(gD.tempo) + 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		gD.setTempo(math.Ceil(gD.tempo) - 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		gD.setTempo(math.Floor(gD.tempo) + 10)
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		gD.setTempo(math.Ceil(gD.tempo) - 10)
+	case inpututil.IsKeyJustPressed(ebiten.KeyT):
+		gD.tapTempo()
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+		if len(typedTempo) > 0 {
+			typedTempo = typedTempo[:len(typedTempo)-1]
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
-		return true
+		if typedTempo == "" {
+			return true
+		}
+		tempo, _ := strconv.Atoi(typedTempo)
+		typedTempo = ""
+		if tempo < globalMinTempo || tempo > globalMaxTempo {
+			gD.showMessage(fmt.Sprint("Le tempo doit être entre ", globalMinTempo, " et ", globalMaxTempo))
+			return false
+		}
+		gD.setTempo(float64(tempo))
 	}
 	return false
 }
@@ -57,29 +84,53 @@ func (gD *GameDisplay) chooseTempoUpdate() bool {
 func (gD *GameDisplay) chooseNumValUpdate() bool {
 	switch {
 	case inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyRight):
-		if gD.automaton.numVal < globalMaxNumVal {
-			gD.automaton.numVal++
+		if gD.automaton.NumVal() < globalMaxNumVal {
+			gD.automaton.SetNumVal(gD.automaton.NumVal() + 1)
+			gD.restoreRules()
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyLeft):
-		if gD.automaton.numVal > globalMinNumVal {
-			gD.automaton.numVal--
+		if gD.automaton.NumVal() > globalMinNumVal {
+			gD.automaton.SetNumVal(gD.automaton.NumVal() - 1)
+			gD.restoreRules()
 		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		gD.automaton.SetRadius(gD.automaton.Radius()%globalMaxRadius + 1)
+		gD.restoreRules()
 	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
 		return true
 	}
 	return false
 }
 
+// saveRules keeps the current rules, to be restored by restoreRules.
+func (gD *GameDisplay) saveRules() {
+	gD.savedRules = append(gD.savedRules[:0], gD.automaton.Rules()...)
+	gD.savedNumVal = gD.automaton.NumVal()
+	gD.savedRadius = gD.automaton.Radius()
+}
+
+// restoreRules converts the rules kept by saveRules to the current
+// number of states and radius.
+func (gD *GameDisplay) restoreRules() {
+	if gD.savedRules != nil {
+		gD.automaton.ConvertRules(gD.savedRules, gD.savedNumVal, gD.savedRadius)
+	}
+}
+
 var currentRule int
 
 func (gD *GameDisplay) chooseRulesUpdate() bool {
+	if typingRuleCode {
+		gD.chooseRuleCodeUpdate()
+		return false
+	}
 	switch {
 	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
 		if (currentRule+7)%8 < currentRule%8 {
 			currentRule--
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
-		if (currentRule+1)%8 > currentRule%8 && currentRule+1 < len(gD.automaton.rules) {
+		if (currentRule+1)%8 > currentRule%8 && currentRule+1 < len(gD.automaton.Rules()) {
 			currentRule++
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
@@ -87,30 +138,109 @@ func (gD *GameDisplay) chooseRulesUpdate() bool {
 			currentRule -= 8
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
-		if currentRule+8 < len(gD.automaton.rules) {
+		if currentRule+8 < len(gD.automaton.Rules()) {
 			currentRule += 8
 		}
 	case inpututil.IsKeyJustPressed(ebiten.KeySpace):
-		gD.automaton.rules[currentRule] = (gD.automaton.rules[currentRule] + 1) % gD.automaton.numVal
+		gD.automaton.SetRule(currentRule, gD.automaton.Rules()[currentRule]+1)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		gD.clickRule(1)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight):
+		gD.clickRule(gD.automaton.NumVal() - 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+		typingRuleCode = true
+		typedRuleCode = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyF):
+		gD.automaton.SetFamily((gD.automaton.Family() + 1) % automaton.RuleFamily(len(familyNames)))
+		currentRule = 0
 	case inpututil.IsKeyJustPressed(ebiten.KeyShift):
 		return true
 	}
 	return false
 }
 
+// clickRule selects the rule under the mouse cursor, if any, and adds
+// delta to its state.
+func (gD *GameDisplay) clickRule(delta int) {
+	mouseX, mouseY := ebiten.CursorPosition()
+	size, width := ruleSize(gD.automaton)
+	for i, state := range gD.automaton.Rules() {
+		x, y := rulePosition(i, rulesX, rulesY)
+		if float64(mouseX) >= x-2 && float64(mouseX) <= x+width+2 && float64(mouseY) >= y-2 && float64(mouseY) <= y+2*size+3 {
+			currentRule = i
+			gD.automaton.SetRule(i, state+delta)
+			return
+		}
+	}
+}
+
+var typingRuleCode bool
+var typedRuleCode string
+
+func (gD *GameDisplay) chooseRuleCodeUpdate() {
+	for _, r := range ebiten.InputChars() {
+		if r >= '0' && r <= '9' {
+			typedRuleCode += string(r)
+		}
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+		if len(typedRuleCode) > 0 {
+			typedRuleCode = typedRuleCode[:len(typedRuleCode)-1]
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		typingRuleCode = false
+		code, ok := new(big.Int).SetString(typedRuleCode, 10)
+		if !ok || gD.automaton.SetRuleCode(code) != nil {
+			gD.showMessage("Ce numéro de règle n'existe pas pour ce nombre d'états")
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+		typingRuleCode = false
+	}
+}
+
 var currentCell int
 
 func (gD *GameDisplay) chooseInitialGridUpdate() bool {
 	switch {
 	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
-		currentCell = (currentCell + len(gD.automaton.initialGrid) - 1) % len(gD.automaton.initialGrid)
+		currentCell = (currentCell + len(gD.automaton.InitialGrid()) - 1) % len(gD.automaton.InitialGrid())
 	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
-		currentCell = (currentCell + 1) % len(gD.automaton.initialGrid)
+		currentCell = (currentCell + 1) % len(gD.automaton.InitialGrid())
 	case inpututil.IsKeyJustPressed(ebiten.KeySpace):
-		gD.automaton.initialGrid[currentCell] = (gD.automaton.initialGrid[currentCell] + 1) % gD.automaton.numVal
-		gD.automaton.grid[currentCell] = gD.automaton.initialGrid[currentCell]
+		gD.automaton.SetInitialCell(currentCell, gD.automaton.InitialGrid()[currentCell]+1)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		gD.clickCell(1)
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight):
+		gD.clickCell(gD.automaton.NumVal() - 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyB):
+		gD.automaton.SetBoundary((gD.automaton.Boundary() + 1) % automaton.Boundary(len(boundaryNames)))
+	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+		gD.automaton.SetBoundaryValue(gD.automaton.BoundaryValue() + 1)
 	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
 		return true
 	}
 	return false
 }
+
+// clickCell selects the cell under the mouse cursor, if any, in the
+// circle or in the score, and adds delta to its initial state.
+func (gD *GameDisplay) clickCell(delta int) {
+	mouseX, mouseY := ebiten.CursorPosition()
+	cA := gD.automaton
+	for i, state := range cA.InitialGrid() {
+		var x, y, half float64
+		if gD.part {
+			x, y, half = partCellCenter(cA, i, partX(cA), partY)
+		} else {
+			var scale float64
+			x, y, scale = cellCenter(cA, i, automatonX, automatonY)
+			half = 11 * scale
+		}
+		if math.Abs(float64(mouseX)-x) <= half && math.Abs(float64(mouseY)-y) <= half {
+			currentCell = i
+			cA.SetInitialCell(i, state+delta)
+			return
+		}
+	}
+}
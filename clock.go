@@ -0,0 +1,106 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/loig/grac/midi"
+)
+
+// leadClock sends the MIDI clock to the MIDI output, which must be open.
+func (gD *GameDisplay) leadClock() {
+	gD.audio.leader = midi.NewLeader(gD.audio.midiOut)
+}
+
+// followClock plays the steps on the MIDI clock read from the port
+// name, or from the first one found for "auto". When the port fails,
+// the steps are played by the internal scheduler again.
+func (gD *GameDisplay) followClock(name string) error {
+	name, err := portName(name)
+	if err != nil {
+		return err
+	}
+	input, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	gD.audio.following = true
+	gD.audio.clockIn = name
+	go func() {
+		err := midi.Follow(input, gD.clockEvent)
+		input.Close()
+		gD.mutex.Lock()
+		defer gD.mutex.Unlock()
+		gD.audio.following = false
+		gD.audio.clockRunning = false
+		if gD.state >= stateRunAutomaton && !gD.audio.scheduler.Playing() {
+			gD.startSteps()
+		}
+		gD.showMessage(fmt.Sprint("Erreur MIDI : ", err, ", horloge interne utilisée"))
+	}()
+	return nil
+}
+
+// clockEvent follows an event of the external MIDI clock, the steps
+// being played only between its start and stop messages.
+func (gD *GameDisplay) clockEvent(e midi.ClockEvent, tempo float64) {
+	gD.mutex.Lock()
+	defer gD.mutex.Unlock()
+	if tempo > 0 && gD.state >= stateChooseTempo {
+		gD.setTempo(math.Round(10*tempo) / 10)
+	}
+	switch e {
+	case midi.ClockStart:
+		gD.audio.clockRunning = true
+		gD.audio.scheduler.Stop()
+		if gD.state >= stateRunAutomaton {
+			gD.automaton.Init()
+		}
+	case midi.ClockContinue:
+		gD.audio.clockRunning = true
+	case midi.ClockStop:
+		gD.audio.clockRunning = false
+		gD.audio.scheduler.Stop()
+		gD.stopMIDI()
+	case midi.ClockStep:
+		if !gD.audio.clockRunning || gD.state < stateRunAutomaton {
+			return
+		}
+		if gD.audio.scheduler.Playing() {
+			gD.audio.scheduler.Sync()
+		} else {
+			gD.audio.scheduler.Start(gD.tempo)
+		}
+	}
+}
+
+// clockName describes the MIDI clock used.
+func (gD *GameDisplay) clockName() string {
+	switch {
+	case gD.audio.leader != nil:
+		return " (horloge envoyée)"
+	case gD.audio.following && gD.audio.clockRunning:
+		return fmt.Sprint(" (horloge suivie : ", gD.audio.clockIn, ")")
+	case gD.audio.following:
+		return fmt.Sprint(" (en attente de l'horloge : ", gD.audio.clockIn, ")")
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func cycleCommand(args []string) error {
+	fs := flag.NewFlagSet("cycle", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	maxSteps := fs.Int("max", 1000000, "nombre maximal de générations calculées pour trouver le cycle")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	transient, period, found := cA.FindCycle(*maxSteps)
+	if !found {
+		fmt.Println("Aucun cycle trouvé en", generations(*maxSteps))
+		return nil
+	}
+	fmt.Println("Transitoire :", generations(transient))
+	fmt.Println("Cycle :", generations(period))
+	return nil
+}
+
+func generations(n int) string {
+	if n <= 1 {
+		return fmt.Sprint(n, " génération")
+	}
+	return fmt.Sprint(n, " générations")
+}
@@ -0,0 +1,267 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/loig/grac/automaton"
+	"github.com/loig/grac/groove"
+	"github.com/loig/grac/session"
+	"github.com/loig/grac/sound"
+)
+
+// automatonFlags are the flags describing an automaton, shared by all
+// the commands.
+type automatonFlags struct {
+	size          int
+	numVal        int
+	radius        int
+	family        string
+	rule          string
+	table         string
+	init          string
+	boundary      string
+	boundaryValue int
+	load          string
+	// loaded is the session read by build, if any.
+	loaded *session.Session
+}
+
+func (aF *automatonFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&aF.size, "size", automaton.DefaultSize, "nombre de cellules")
+	fs.IntVar(&aF.numVal, "states", automaton.DefaultNumVal, "nombre d'états par cellule")
+	fs.IntVar(&aF.radius, "radius", automaton.DefaultRadius, "nombre de voisines de chaque côté d'une cellule (plus de 1 seulement avec 2 états)")
+	fs.StringVar(&aF.family, "family", "table", "famille de règles : table, totalistic (somme des trois cellules) ou outer-totalistic (cellule et somme de ses voisines)")
+	fs.StringVar(&aF.rule, "rule", "0", "numéro de la règle (code de Wolfram pour 2 états, code en base k pour k états)")
+	fs.StringVar(&aF.table, "table", "", "table des règles, un chiffre par règle en commençant par la règle 0")
+	fs.StringVar(&aF.init, "init", "", "état initial, un chiffre par cellule (par défaut seule la cellule du milieu est à 1)")
+	fs.StringVar(&aF.boundary, "boundary", "periodic", "bords : periodic (anneau), fixed (valeur fixe), reflecting (miroir) ou null (état 0)")
+	fs.IntVar(&aF.boundaryValue, "boundary-value", 0, "état des cellules au-delà des bords avec -boundary fixed")
+	fs.StringVar(&aF.load, "load", "", "session à charger (remplace les autres options de l'automate)")
+}
+
+func (aF *automatonFlags) build() (*automaton.CelAut, error) {
+	if aF.load != "" {
+		s, err := session.LoadFile(aF.load)
+		if err != nil {
+			return nil, err
+		}
+		aF.loaded = s
+		return s.Automaton()
+	}
+
+	if aF.size < automaton.MinSize || aF.size > automaton.MaxSize {
+		return nil, fmt.Errorf("le nombre de cellules doit être entre %d et %d", automaton.MinSize, automaton.MaxSize)
+	}
+	if aF.numVal < automaton.MinNumVal || aF.numVal > automaton.MaxNumVal {
+		return nil, fmt.Errorf("le nombre d'états doit être entre %d et %d", automaton.MinNumVal, automaton.MaxNumVal)
+	}
+
+	if aF.radius < automaton.MinRadius || aF.radius > automaton.MaxRadius {
+		return nil, fmt.Errorf("le rayon doit être entre %d et %d", automaton.MinRadius, automaton.MaxRadius)
+	}
+	if aF.radius > 1 && aF.numVal > 2 {
+		return nil, errors.New("un rayon supérieur à 1 n'est possible qu'avec 2 états")
+	}
+	family, err := automaton.ParseRuleFamily(aF.family)
+	if err != nil {
+		return nil, err
+	}
+	boundary, err := automaton.ParseBoundary(aF.boundary)
+	if err != nil {
+		return nil, err
+	}
+	if aF.boundaryValue < 0 || aF.boundaryValue >= aF.numVal {
+		return nil, fmt.Errorf("l'état des bords doit être entre 0 et %d", aF.numVal-1)
+	}
+
+	cA := automaton.New()
+	cA.SetSize(aF.size)
+	cA.SetNumVal(aF.numVal)
+	cA.SetRadius(aF.radius)
+	cA.SetFamily(family)
+
+	if aF.table != "" {
+		rules, err := parseDigits(aF.table, aF.numVal)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) != len(cA.Rules()) {
+			return nil, fmt.Errorf("la table doit contenir %d règles", len(cA.Rules()))
+		}
+		for i, state := range rules {
+			cA.SetRule(i, state)
+		}
+	} else {
+		code, ok := new(big.Int).SetString(aF.rule, 10)
+		if !ok {
+			return nil, fmt.Errorf("%q n'est pas un numéro de règle valide", aF.rule)
+		}
+		if err := cA.SetRuleCode(code); err != nil {
+			return nil, err
+		}
+	}
+
+	var initialGrid []int
+	if aF.init != "" {
+		initialGrid, err = parseDigits(aF.init, aF.numVal)
+		if err != nil {
+			return nil, err
+		}
+		if len(initialGrid) != aF.size {
+			return nil, fmt.Errorf("l'état initial doit contenir %d cellules", aF.size)
+		}
+	} else {
+		initialGrid = make([]int, aF.size)
+		initialGrid[aF.size/2] = 1
+	}
+	for i, state := range initialGrid {
+		cA.SetInitialCell(i, state)
+	}
+	cA.SetBoundary(boundary)
+	cA.SetBoundaryValue(aF.boundaryValue)
+
+	cA.Init()
+	return cA, nil
+}
+
+// timingFlags are the flags giving the timing and the dynamics of the
+// steps, shared by the commands writing files.
+type timingFlags struct {
+	tempo  float64
+	swing  float64
+	groove string
+	accent string
+	// loaded is the groove of the loaded session, if any.
+	loaded *groove.Groove
+}
+
+func (tF *timingFlags) register(fs *flag.FlagSet) {
+	fs.Float64Var(&tF.tempo, "tempo", 80, "tempo (nombre de générations par minute)")
+	fs.Float64Var(&tF.swing, "swing", 0, fmt.Sprint("position en pour cent d'une génération sur deux, entre ", groove.MinSwing, " (régulier) et ", groove.MaxSwing))
+	fs.StringVar(&tF.groove, "groove", "straight", "groove : straight, swing, shuffle, laid-back, push ou liste de décalages en fractions de génération comme 0,0.1,0,0.05")
+	fs.StringVar(&tF.accent, "accent", "none", "nuances : none (aucune), changes (cellules qui changent d'état), neighbors (voisines actives) ou cycle (position dans le cycle)")
+}
+
+// useSession takes the timing parameters that are not set in fs from s.
+func (tF *timingFlags) useSession(fs *flag.FlagSet, s *session.Session) {
+	if !isSet(fs, "tempo") {
+		tF.tempo = s.Tempo
+	}
+	if !isSet(fs, "swing") && !isSet(fs, "groove") {
+		g := s.Groove()
+		tF.loaded = &g
+	}
+	if !isSet(fs, "accent") {
+		tF.accent = s.Accent
+	}
+}
+
+// velocities returns the velocities of the cells of generations, whose
+// cycle starts at generation transient and lasts period generations,
+// the neighbors of the cells being given by neighbors.
+func (tF *timingFlags) velocities(generations [][]int, neighbors sound.Neighbors, transient, period int) ([][]float64, error) {
+	accent, err := sound.ParseAccent(tF.accent)
+	if err != nil {
+		return nil, err
+	}
+	if accent == sound.NoAccent {
+		return nil, nil
+	}
+	return accent.AllVelocities(generations, neighbors, transient, period), nil
+}
+
+func (tF *timingFlags) build() (groove.Groove, error) {
+	if tF.tempo <= 0 {
+		return groove.Groove{}, errors.New("le tempo doit être strictement positif")
+	}
+	if tF.loaded != nil {
+		return *tF.loaded, nil
+	}
+	g, err := groove.Parse(tF.groove)
+	if err != nil {
+		return g, err
+	}
+	if tF.swing != 0 {
+		g.Swing = tF.swing
+	}
+	return g, g.Check()
+}
+
+// windowFlags are the flags choosing the audible cells, shared by the
+// commands writing files.
+type windowFlags struct {
+	listen string
+	// loaded is the window of the loaded session, if any.
+	loaded *sound.Window
+}
+
+func (wF *windowFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&wF.listen, "listen", "", "cellules entendues, numérotées à partir de 1, comme 5-8 ou 1,5,9, suivies de :v pour jouer la voix v (par défaut toutes les cellules)")
+}
+
+// useSession takes the audible cells from s if they are not set in fs.
+func (wF *windowFlags) useSession(fs *flag.FlagSet, s *session.Session) {
+	if !isSet(fs, "listen") {
+		w := s.Window()
+		wF.loaded = &w
+	}
+}
+
+// build returns the audible cells of an automaton of numCells cells.
+func (wF *windowFlags) build(numCells int) (sound.Window, error) {
+	if wF.loaded != nil {
+		return *wF.loaded, nil
+	}
+	if wF.listen == "" {
+		return sound.Window{}, nil
+	}
+	w, err := sound.ParseWindow(wF.listen)
+	if err != nil {
+		return w, err
+	}
+	return w, w.Check(numCells, automaton.MaxNumVal-1)
+}
+
+// isSet tells if the named flag was given on the command line.
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// parseDigits reads a sequence of states, one digit per state.
+func parseDigits(digits string, numVal int) ([]int, error) {
+	res := make([]int, 0, len(digits))
+	for _, d := range digits {
+		state := int(d - '0')
+		if state < 0 || state >= numVal {
+			return nil, fmt.Errorf("%q n'est pas un état valide (0 à %d)", d, numVal-1)
+		}
+		res = append(res, state)
+	}
+	return res, nil
+}
@@ -0,0 +1,96 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/sound"
+)
+
+func loopCommand(args []string) error {
+	fs := flag.NewFlagSet("loop", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	maxSteps := fs.Int("max", 1000000, "nombre maximal de générations calculées pour trouver le cycle")
+	stepsPerBar := fs.Int("bar", 4, "nombre de générations par mesure")
+	intro := fs.Bool("intro", false, "commencer par les générations avant le cycle")
+	var tF timingFlags
+	tF.register(fs)
+	var wF windowFlags
+	wF.register(fs)
+	var sF soundFlags
+	sF.register(fs)
+	output := fs.String("o", "grac-loop.mid", "fichier à écrire, MIDI (.mid) ou WAV (.wav)")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	if aF.loaded != nil {
+		tF.useSession(fs, aF.loaded)
+		wF.useSession(fs, aF.loaded)
+		sF.useSession(fs, aF.loaded)
+	}
+	g, err := tF.build()
+	if err != nil {
+		return err
+	}
+	window, err := wF.build(cA.Size())
+	if err != nil {
+		return err
+	}
+	if *stepsPerBar <= 0 {
+		return errors.New("le nombre de générations par mesure doit être strictement positif")
+	}
+	loop, found := cA.FindLoop(*maxSteps)
+	if !found {
+		return fmt.Errorf("aucun cycle trouvé en %s", generations(*maxSteps))
+	}
+	grids := loop.Bars(*stepsPerBar, *intro)
+	velocities, err := tF.velocities(grids, cA.Neighbors, loop.BarsIntro(*stepsPerBar, *intro), len(loop.Cycle))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(*output) {
+	case ".wav":
+		var pcm []byte
+		pcm, err = sF.render(window.Generations(grids), sound.Options{Tempo: tF.tempo, Groove: g, Velocities: velocities})
+		if err == nil {
+			err = sound.WriteWAV(file, pcm)
+		}
+	default:
+		err = midi.WriteSMF(file, window.Generations(grids), midi.Options{Tempo: tF.tempo, Mapping: midi.MapDrums, Groove: g, Accents: velocities})
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
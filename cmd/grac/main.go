@@ -0,0 +1,79 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Command grac runs GRAC automata without graphical interface.
+//
+// Usage:
+//
+//	grac run [flags]
+//	grac midi [flags]
+//	grac wav [flags]
+//	grac cycle [flags]
+//	grac loop [flags]
+//	grac play [flags]
+//	grac osc [flags] address [arguments]
+//
+// Use grac <command> -h for the flags of a command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []command = []command{
+	{"run", "affiche les générations successives d'un automate", runCommand},
+	{"midi", "enregistre les générations d'un automate dans un fichier MIDI", midiCommand},
+	{"wav", "enregistre le rendu sonore d'un automate dans un fichier WAV", wavCommand},
+	{"cycle", "donne la longueur du transitoire et du cycle d'un automate", cycleCommand},
+	{"loop", "enregistre le cycle d'un automate en boucle d'un nombre entier de mesures", loopCommand},
+	{"play", "joue un automate en direct sur un port MIDI", playCommand},
+	{"osc", "envoie un message OSC à grac ou affiche les messages reçus", oscCommand},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Utilisation : grac <commande> [options]")
+	fmt.Fprintln(os.Stderr, "Commandes :")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "   %-8s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "grac:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
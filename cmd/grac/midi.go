@@ -0,0 +1,86 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/loig/grac/midi"
+)
+
+func midiCommand(args []string) error {
+	fs := flag.NewFlagSet("midi", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	numGen := fs.Int("gens", 64, "nombre de générations après l'état initial")
+	var tF timingFlags
+	tF.register(fs)
+	var wF windowFlags
+	wF.register(fs)
+	mapping := fs.String("map", "tracks", "tracks : une piste par cellule, drums : une note de percussion par cellule")
+	output := fs.String("o", "grac.mid", "fichier MIDI à écrire")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	if aF.loaded != nil {
+		tF.useSession(fs, aF.loaded)
+		wF.useSession(fs, aF.loaded)
+	}
+	g, err := tF.build()
+	if err != nil {
+		return err
+	}
+	window, err := wF.build(cA.Size())
+	if err != nil {
+		return err
+	}
+	if *numGen < 0 {
+		return errors.New("le nombre de générations doit être positif")
+	}
+	generations := cA.Generations(*numGen)
+	transient, period, _ := cA.FindCycle(*numGen)
+	accents, err := tF.velocities(generations, cA.Neighbors, transient, period)
+	if err != nil {
+		return err
+	}
+	opts := midi.Options{Tempo: tF.tempo, Groove: g, Accents: accents}
+	switch *mapping {
+	case "tracks":
+		opts.Mapping = midi.MapTracks
+	case "drums":
+		opts.Mapping = midi.MapDrums
+	default:
+		return fmt.Errorf("%q n'est pas une correspondance valide (tracks ou drums)", *mapping)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := midi.WriteSMF(file, window.Generations(generations), opts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,64 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/loig/grac/osc"
+)
+
+func oscCommand(args []string) error {
+	fs := flag.NewFlagSet("osc", flag.ExitOnError)
+	to := fs.String("to", "localhost:9000", "adresse UDP du serveur OSC de grac")
+	listen := fs.String("listen", "", "adresse UDP où recevoir et afficher les messages, par exemple :9001, au lieu d'envoyer un message")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Utilisation : grac osc [options] adresse [arguments...], par exemple grac osc /grac/tempo 120")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *listen != "" {
+		server, err := osc.Listen(*listen)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+		return server.Serve(func(m osc.Message, from *net.UDPAddr) {
+			fmt.Println(m.Address, m.Args)
+		})
+	}
+	if fs.NArg() == 0 {
+		return errors.New("il manque l'adresse du message")
+	}
+	m := osc.NewMessage(fs.Arg(0))
+	for _, arg := range fs.Args()[1:] {
+		if i, err := strconv.ParseInt(arg, 10, 32); err == nil {
+			m.Args = append(m.Args, int32(i))
+		} else if f, err := strconv.ParseFloat(arg, 32); err == nil {
+			m.Args = append(m.Args, float32(f))
+		} else {
+			m.Args = append(m.Args, arg)
+		}
+	}
+	return osc.Send(*to, m)
+}
@@ -0,0 +1,225 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/sound"
+)
+
+func playCommand(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	numGen := fs.Int("gens", 0, "nombre de générations après l'état initial (0 : sans fin)")
+	var tF timingFlags
+	tF.register(fs)
+	var wF windowFlags
+	wF.register(fs)
+	port := fs.String("port", "", "port MIDI, par exemple /dev/snd/midiC1D0 (par défaut le premier port trouvé)")
+	clock := fs.String("clock", "", "horloge MIDI : lead pour l'envoyer sur le port, follow pour suivre celle du port -in")
+	in := fs.String("in", "", "port MIDI dont l'horloge est suivie avec -clock follow (par défaut le port -port)")
+	notes := fs.String("notes", "10:36,10:38,10:42,10:46", "canal (1 à 16) et note joués par chaque état, séparés par des virgules")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	if aF.loaded != nil {
+		tF.useSession(fs, aF.loaded)
+		wF.useSession(fs, aF.loaded)
+	}
+	g, err := tF.build()
+	if err != nil {
+		return err
+	}
+	window, err := wF.build(cA.Size())
+	if err != nil {
+		return err
+	}
+	accent, err := sound.ParseAccent(tF.accent)
+	if err != nil {
+		return err
+	}
+	if *numGen < 0 {
+		return errors.New("le nombre de générations doit être positif")
+	}
+	stateNotes, err := midi.ParseStateNotes(*notes)
+	if err != nil {
+		return err
+	}
+	if *port == "" {
+		ports := midi.Ports()
+		if len(ports) == 0 {
+			return errors.New("aucun port MIDI trouvé (le module snd-virmidi crée des ports virtuels)")
+		}
+		*port = ports[0]
+	}
+	out, err := midi.OpenPort(*port)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Sortie MIDI :", out.Name())
+
+	var leader *midi.Leader
+	var events chan clockEvent
+	followErr := make(chan error, 1)
+	switch *clock {
+	case "":
+	case "lead":
+		leader = midi.NewLeader(out)
+		if err := leader.Start(); err != nil {
+			out.Close()
+			return err
+		}
+	case "follow":
+		if *in == "" {
+			*in = out.Name()
+		}
+		input, err := os.Open(*in)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		defer input.Close()
+		events = make(chan clockEvent, midi.ClocksPerStep)
+		go func() {
+			followErr <- midi.Follow(input, func(e midi.ClockEvent, tempo float64) {
+				events <- clockEvent{e, tempo}
+			})
+		}()
+		fmt.Fprintln(os.Stderr, "Horloge MIDI suivie :", *in)
+	default:
+		out.Close()
+		return fmt.Errorf("%q n'est pas une horloge MIDI valide (lead ou follow)", *clock)
+	}
+	stop := func() error {
+		if leader != nil {
+			leader.Stop()
+		}
+		return out.Close()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	stepLength := 60 / tF.tempo
+	start := time.Now()
+	running := false
+	var previous []int
+	for step := 0; *numGen == 0 || step <= *numGen; step++ {
+		at := start.Add(seconds(math.Max(0, float64(step)+g.Offset(step)) * stepLength))
+		if leader != nil {
+			leader.Step(start.Add(seconds(float64(step)*stepLength)), seconds(stepLength))
+			if err := leader.Err(); err != nil {
+				stop()
+				return err
+			}
+		}
+		if events != nil {
+			// the step starts with the next step of the clock, shifted
+			// by the groove when it is late
+			for waiting := true; waiting; {
+				select {
+				case <-interrupt:
+					return stop()
+				case err := <-followErr:
+					if err == io.EOF {
+						return stop()
+					}
+					stop()
+					return err
+				case e := <-events:
+					if e.tempo > 0 {
+						stepLength = 60 / e.tempo
+					}
+					switch e.event {
+					case midi.ClockStart:
+						running = true
+						cA.Init()
+						step = 0
+					case midi.ClockContinue:
+						running = true
+					case midi.ClockStop:
+						running = false
+						out.Stop()
+					case midi.ClockStep:
+						waiting = !running
+					}
+				}
+			}
+			at = time.Now().Add(seconds(math.Max(0, g.Offset(step)) * stepLength))
+		}
+		select {
+		case <-interrupt:
+			return stop()
+		case <-time.After(time.Until(at)):
+		}
+		previous = nil
+		if step > 0 {
+			previous = cA.LastGrid()
+		}
+		grid := cA.Grid()
+		cyclePos, period := 0, 0
+		if transient, p, found := cA.Cycle(); found && cA.Generation() >= transient {
+			cyclePos, period = (cA.Generation()-transient)%p, p
+		}
+		var velocities []float64
+		if accent != sound.NoAccent {
+			velocities = accent.Velocities(grid, previous, cA.Neighbors, cyclePos, period)
+		}
+		if err := out.Play(midi.StepNotes(window.Grid(grid), stateNotes, velocities, nil)); err != nil {
+			stop()
+			return err
+		}
+		fmt.Println(digits(grid))
+		cA.Update()
+	}
+	time.Sleep(seconds(stepLength))
+	return stop()
+}
+
+// clockEvent is an event of the followed MIDI clock.
+type clockEvent struct {
+	event midi.ClockEvent
+	tempo float64
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func digits(grid []int) string {
+	var line strings.Builder
+	for _, state := range grid {
+		line.WriteByte(byte('0' + state))
+	}
+	return line.String()
+}
@@ -0,0 +1,65 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	numGen := fs.Int("gens", 20, "nombre de générations après l'état initial (0 : sans fin)")
+	chars := fs.String("chars", "", "caractères représentant chaque état (par défaut 0, 1, 2...)")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	if *numGen < 0 {
+		return errors.New("le nombre de générations doit être positif")
+	}
+	symbols := []rune("0123456789")
+	if *chars != "" {
+		symbols = []rune(*chars)
+		if len(symbols) < cA.NumVal() {
+			return fmt.Errorf("il faut au moins %d caractères pour représenter les états", cA.NumVal())
+		}
+	}
+
+	var line strings.Builder
+	for {
+		line.Reset()
+		for _, state := range cA.Grid() {
+			line.WriteRune(symbols[state])
+		}
+		if _, err := fmt.Fprintln(os.Stdout, line.String()); err != nil {
+			return err
+		}
+		if *numGen != 0 && cA.Generation() >= *numGen {
+			return nil
+		}
+		cA.Update()
+	}
+}
@@ -0,0 +1,155 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/loig/grac/assets"
+	"github.com/loig/grac/session"
+	"github.com/loig/grac/sound"
+)
+
+// defaultSoundDir is the directory of additional sound sets, as in the
+// graphical interface.
+const defaultSoundDir = "grac-sounds"
+
+// soundFlags are the flags choosing the sounds of a WAV file.
+type soundFlags struct {
+	soundset int
+	soundDir string
+	synth    string
+	pitch    string
+	scale    string
+	voices   int
+	// pitchMap is the pitch mapping of the loaded session, if any.
+	pitchMap *sound.PitchMap
+	// mixer is the mixer of the loaded session, if any.
+	mixer *sound.Mixer
+}
+
+func (sF *soundFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&sF.soundset, "soundset", 0, fmt.Sprint("jeu de sons utilisé (", len(assets.SoundSets), " pour les sons synthétisés, les suivants pour ceux du dossier -sounds)"))
+	fs.StringVar(&sF.soundDir, "sounds", defaultSoundDir, "dossier des jeux de sons supplémentaires")
+	fs.StringVar(&sF.synth, "synth", "", "sons synthétisés, instrument:hauteur:durée pour chaque état séparés par des virgules (instruments : kick, snare, hihat, clap, tone)")
+	fs.StringVar(&sF.pitch, "pitch", "none", "hauteur des sons selon la position des cellules : none (aucune), timbre (l'état choisit le son) ou octave (l'état choisit l'octave)")
+	fs.StringVar(&sF.scale, "scale", "major", "gamme jouée par les cellules : major, pentatonic, chromatic ou liste de demi-tons comme 0,3,5,7,10")
+	fs.IntVar(&sF.voices, "voices", sound.DefaultMaxVoices, "nombre maximal de sons joués en même temps par chaque état (0 pour ne pas limiter)")
+}
+
+// useSession takes the sound parameters that are not set in fs from s.
+func (sF *soundFlags) useSession(fs *flag.FlagSet, s *session.Session) {
+	if !isSet(fs, "soundset") {
+		sF.soundset = s.SoundSet
+	}
+	if !isSet(fs, "pitch") && !isSet(fs, "scale") {
+		pitchMap := s.PitchMap()
+		sF.pitchMap = &pitchMap
+	}
+	mixer := s.SoundMixer()
+	sF.mixer = &mixer
+	if !isSet(fs, "voices") {
+		sF.voices = mixer.MaxVoices
+	}
+}
+
+// render renders generations with the chosen sounds, as given by opts
+// and the mixer.
+func (sF *soundFlags) render(generations [][]int, opts sound.Options) ([]byte, error) {
+	sounds, err := sF.decode()
+	if err != nil {
+		return nil, err
+	}
+	var pitchMap sound.PitchMap
+	if sF.pitchMap != nil {
+		pitchMap = *sF.pitchMap
+	} else {
+		pitchMap.Mode, err = sound.ParsePitchMode(sF.pitch)
+		if err != nil {
+			return nil, err
+		}
+		pitchMap.Scale, err = sound.ParseScale(sF.scale)
+		if err != nil {
+			return nil, err
+		}
+	}
+	numCells := 0
+	if len(generations) > 0 {
+		numCells = len(generations[0])
+	}
+	if sF.voices < 0 {
+		return nil, errors.New("le nombre de sons joués en même temps doit être positif")
+	}
+	if sF.mixer != nil {
+		opts.Mixer = *sF.mixer
+	}
+	opts.Mixer.MaxVoices = sF.voices
+	return sound.RenderCells(generations, pitchMap.CellSounds(sounds, numCells), opts), nil
+}
+
+// decode decodes the chosen sound set: the built-in ones come first,
+// then the synthesized one, then those of the sound directory.
+func (sF *soundFlags) decode() ([][]byte, error) {
+	numBuiltin := len(assets.SoundSets)
+	if sF.soundset < numBuiltin {
+		if sF.soundset < 0 {
+			return nil, fmt.Errorf("le jeu de sons doit être positif")
+		}
+		sounds := make([][]byte, len(assets.SoundSets[sF.soundset]))
+		for i, data := range assets.SoundSets[sF.soundset] {
+			var err error
+			sounds[i], err = sound.DecodeMP3(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return sounds, nil
+	}
+
+	if sF.soundset == numBuiltin {
+		voices := sound.DefaultVoices
+		if sF.synth != "" {
+			var err error
+			voices, err = sound.ParseVoices(sF.synth)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return sound.SynthesizeAll(voices), nil
+	}
+
+	sets, err := sound.ReadSoundSets(sF.soundDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if sF.soundset > numBuiltin+len(sets) {
+		return nil, fmt.Errorf("le jeu de sons doit être entre 0 et %d", numBuiltin+len(sets))
+	}
+	files := sets[sF.soundset-numBuiltin-1].Files
+	sounds := make([][]byte, len(files))
+	for i, file := range files {
+		sounds[i], err = sound.Decode(file.Name, file.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name, err)
+		}
+	}
+	return sounds, nil
+}
@@ -0,0 +1,82 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/loig/grac/sound"
+)
+
+func wavCommand(args []string) error {
+	fs := flag.NewFlagSet("wav", flag.ExitOnError)
+	var aF automatonFlags
+	aF.register(fs)
+	numGen := fs.Int("gens", 64, "nombre de générations après l'état initial")
+	var tF timingFlags
+	tF.register(fs)
+	var wF windowFlags
+	wF.register(fs)
+	var sF soundFlags
+	sF.register(fs)
+	output := fs.String("o", "grac.wav", "fichier WAV à écrire")
+	fs.Parse(args)
+
+	cA, err := aF.build()
+	if err != nil {
+		return err
+	}
+	if aF.loaded != nil {
+		tF.useSession(fs, aF.loaded)
+		wF.useSession(fs, aF.loaded)
+		sF.useSession(fs, aF.loaded)
+	}
+	if *numGen < 0 {
+		return errors.New("le nombre de générations doit être positif")
+	}
+	g, err := tF.build()
+	if err != nil {
+		return err
+	}
+	window, err := wF.build(cA.Size())
+	if err != nil {
+		return err
+	}
+	generations := cA.Generations(*numGen)
+	transient, period, _ := cA.FindCycle(*numGen)
+	velocities, err := tF.velocities(generations, cA.Neighbors, transient, period)
+	if err != nil {
+		return err
+	}
+	pcm, err := sF.render(window.Generations(generations), sound.Options{Tempo: tF.tempo, Groove: g, Velocities: velocities})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := sound.WriteWAV(file, pcm); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
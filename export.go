@@ -0,0 +1,86 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/sound"
+)
+
+const (
+	exportGenerations = 64
+	messageFrames     = 180
+)
+
+func exportFileName(ext string) string {
+	return "grac-" + time.Now().Format("20060102-150405") + ext
+}
+
+func (gD *GameDisplay) exportMIDI() {
+	fileName := exportFileName(".mid")
+	file, err := os.Create(fileName)
+	if err == nil {
+		generations := gD.exportedGenerations()
+		err = midi.WriteSMF(file, gD.audio.window.Generations(generations), midi.Options{
+			Tempo:   gD.tempo,
+			Mapping: midi.MapDrums,
+			Groove:  gD.groove,
+			Accents: gD.exportedVelocities(generations),
+		})
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		gD.showMessage(fmt.Sprint("Erreur : ", err))
+		return
+	}
+	gD.showMessage(fmt.Sprint("Fichier MIDI enregistré : ", fileName))
+}
+
+func (gD *GameDisplay) exportWAV() {
+	fileName := exportFileName(".wav")
+	generations := gD.exportedGenerations()
+	pcm := sound.RenderCells(gD.audio.window.Generations(generations), gD.cellSounds(), sound.Options{
+		Tempo:      gD.tempo,
+		Groove:     gD.groove,
+		Mixer:      gD.audio.mixer,
+		Velocities: gD.exportedVelocities(generations),
+	})
+	file, err := os.Create(fileName)
+	if err == nil {
+		err = sound.WriteWAV(file, pcm)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		gD.showMessage(fmt.Sprint("Erreur : ", err))
+		return
+	}
+	gD.showMessage(fmt.Sprint("Fichier WAV enregistré : ", fileName))
+}
+
+func (gD *GameDisplay) showMessage(message string) {
+	gD.message = message
+	gD.messageFrame = messageFrames
+}
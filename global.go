@@ -18,19 +18,24 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package main
 
 import (
+	"fmt"
 	"image/color"
-	"sort"
+
+	"github.com/loig/grac/automaton"
 )
 
 const (
-	globalMinSize       = 3
-	globalDefaultSize   = 25
-	globalMaxSize       = 40
-	globalMinNumVal     = 2
-	globalDefaultNumVal = 2
-	globalMaxNumVal     = 5
-	globalDisplayLine   = 36
-	numSoundSet         = 2
+	globalMinSize       = automaton.MinSize
+	globalDefaultSize   = automaton.DefaultSize
+	globalMaxSize       = automaton.MaxSize
+	globalMinNumVal     = automaton.MinNumVal
+	globalDefaultNumVal = automaton.DefaultNumVal
+	globalMaxNumVal     = automaton.MaxNumVal
+	globalMaxRadius     = automaton.MaxRadius
+	globalDisplayLine   = automaton.ScoreLength + 1
+	globalMinTempo      = 4 // above midi.MinTempo, for the MIDI export
+	globalDefaultTempo  = 80
+	globalMaxTempo      = 3600
 )
 
 var stateColors []color.Color = []color.Color{
@@ -41,31 +46,24 @@ var stateColors []color.Color = []color.Color{
 	color.RGBA{51, 153, 255, 255},
 }
 
-var sounds [numSoundSet][globalMaxNumVal - 1][]byte
-
-var tempos []int = genTempos()
+var familyNames []string = []string{
+	"",
+	" (totalistiques)",
+	" (totalistiques externes)",
+}
 
-func genTempos() []int {
-	// 3600 frames per minute, these are the prime dividers of 3600
-	primeDiv := []int{2, 2, 2, 2, 3, 3, 5, 5}
-	res := genDiv(primeDiv)
-	sort.Ints(res)
-	return res
+var boundaryNames []string = []string{
+	"anneau",
+	"bords fixés à ",
+	"bords réfléchissants",
+	"bords nuls",
 }
 
-func genDiv(primeDiv []int) []int {
-	if len(primeDiv) == 0 {
-		return []int{1}
-	}
-	i := 1
-	for cur := primeDiv[0]; i < len(primeDiv) && primeDiv[i] == cur; i++ {
-	}
-	divs := genDiv(primeDiv[i:])
-	numDivs := len(divs)
-	for j := 0; j < i; j++ {
-		for k := 0; k < numDivs; k++ {
-			divs = append(divs, divs[k+j*numDivs]*primeDiv[0])
-		}
+var sounds [][globalMaxNumVal - 1][]byte
+
+func generations(n int) string {
+	if n <= 1 {
+		return fmt.Sprint(n, " génération")
 	}
-	return divs
+	return fmt.Sprint(n, " générations")
 }
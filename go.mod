@@ -4,4 +4,6 @@ go 1.15
 
 require (
 	github.com/hajimehoshi/ebiten/v2 v2.0.5
+	github.com/hajimehoshi/go-mp3 v0.3.1
+	github.com/jfreymuth/oggvorbis v1.0.1
 )
@@ -0,0 +1,91 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/loig/grac/groove"
+)
+
+var grooveNames []string = []string{
+	"régulier",
+	"swing",
+	"shuffle",
+	"en retard",
+	"en avance",
+}
+
+// cycleGroove replaces the groove by the next predefined one.
+func (gD *GameDisplay) cycleGroove() {
+	gD.groovePos = (gD.groovePos + 1) % len(groove.Templates)
+	gD.setGroove(groove.Templates[gD.groovePos].Groove)
+}
+
+// changeSwing adds delta to the swing of the groove.
+func (gD *GameDisplay) changeSwing(delta float64) {
+	g := gD.groove
+	g.Swing = math.Min(math.Max(math.Max(g.Swing, groove.MinSwing)+delta, groove.MinSwing), groove.MaxSwing)
+	gD.setSessionGroove(g)
+}
+
+func (gD *GameDisplay) setGroove(g groove.Groove) {
+	gD.groove = g
+	gD.audio.scheduler.SetGroove(g)
+}
+
+// setSessionGroove sets a groove that may not be a predefined one, it
+// is named after the predefined groove with the same swing and offsets,
+// if any.
+func (gD *GameDisplay) setSessionGroove(g groove.Groove) {
+	gD.groovePos = -1
+	for i, t := range groove.Templates {
+		if sameSwing(t.Groove.Swing, g.Swing) && sameOffsets(t.Groove.Offsets, g.Offsets) {
+			gD.groovePos = i
+			break
+		}
+	}
+	gD.setGroove(g)
+}
+
+// sameSwing tells if two swings are the same, a swing of 0 being
+// regular.
+func sameSwing(s1, s2 float64) bool {
+	return math.Max(s1, groove.MinSwing) == math.Max(s2, groove.MinSwing)
+}
+
+func sameOffsets(o1, o2 []float64) bool {
+	if len(o1) != len(o2) {
+		return false
+	}
+	for i := range o1 {
+		if o1[i] != o2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (gD *GameDisplay) grooveName() string {
+	name := "personnalisé"
+	if gD.groovePos >= 0 {
+		name = grooveNames[gD.groovePos]
+	}
+	return fmt.Sprint(name, ", swing ", math.Max(gD.groove.Swing, groove.MinSwing), " %")
+}
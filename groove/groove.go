@@ -0,0 +1,106 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package groove describes the timing of the steps of GRAC rhythms,
+// whose starts can be shifted so that they sound less mechanical.
+package groove
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinSwing and MaxSwing are the limits of Groove.Swing.
+	MinSwing = 50
+	MaxSwing = 75
+	// MaxOffset is the limit of the absolute value of Groove.Offsets.
+	MaxOffset = 0.25
+)
+
+// Groove shifts the start of the steps. A zero Groove keeps the steps
+// evenly spaced.
+type Groove struct {
+	// Swing is the position, in percent, of the start of every second
+	// step between the starts of the steps around it: 50 keeps it in the
+	// middle and 67 gives a triplet shuffle. 0 is the same as 50.
+	Swing float64
+	// Offsets are added in turn to the start of the steps, in fractions
+	// of a step.
+	Offsets []float64
+}
+
+// Templates are the predefined grooves.
+var Templates = []struct {
+	Name   string
+	Groove Groove
+}{
+	{"straight", Groove{Swing: 50}},
+	{"swing", Groove{Swing: 58}},
+	{"shuffle", Groove{Swing: 67}},
+	{"laid-back", Groove{Swing: 50, Offsets: []float64{0, 0.06, 0.03, 0.09}}},
+	{"push", Groove{Swing: 50, Offsets: []float64{0, -0.06, -0.03, -0.09}}},
+}
+
+// Parse returns the predefined groove with the given name, or the
+// straight groove with the offsets given as a comma separated list, for
+// example "0,0.1,0,0.05".
+func Parse(spec string) (Groove, error) {
+	for _, t := range Templates {
+		if t.Name == spec {
+			return t.Groove, nil
+		}
+	}
+	g := Groove{Swing: MinSwing}
+	for _, field := range strings.Split(spec, ",") {
+		offset, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return g, fmt.Errorf("groove: invalid groove %q", spec)
+		}
+		g.Offsets = append(g.Offsets, offset)
+	}
+	return g, g.Check()
+}
+
+// Check tells if the swing and the offsets of g are within their
+// limits, so that the steps stay in order. NaN is never within them.
+func (g Groove) Check() error {
+	if g.Swing != 0 && !(g.Swing >= MinSwing && g.Swing <= MaxSwing) {
+		return fmt.Errorf("groove: invalid swing %v", g.Swing)
+	}
+	for _, offset := range g.Offsets {
+		if !(offset >= -MaxOffset && offset <= MaxOffset) {
+			return fmt.Errorf("groove: invalid offset %v", offset)
+		}
+	}
+	return nil
+}
+
+// Offset returns the shift of the start of the given step, in fractions
+// of a step.
+func (g Groove) Offset(step int) float64 {
+	res := 0.0
+	if step%2 == 1 && g.Swing > MinSwing {
+		res = (g.Swing - MinSwing) / MinSwing
+	}
+	if len(g.Offsets) > 0 {
+		res += g.Offsets[step%len(g.Offsets)]
+	}
+	return res
+}
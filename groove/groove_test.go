@@ -0,0 +1,137 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package groove
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Groove
+	}{
+		{"straight", Groove{Swing: 50}},
+		{"swing", Groove{Swing: 58}},
+		{"shuffle", Groove{Swing: 67}},
+		{"laid-back", Groove{Swing: 50, Offsets: []float64{0, 0.06, 0.03, 0.09}}},
+		{"push", Groove{Swing: 50, Offsets: []float64{0, -0.06, -0.03, -0.09}}},
+		{"0", Groove{Swing: 50, Offsets: []float64{0}}},
+		{"0, 0.1,0,-0.05", Groove{Swing: 50, Offsets: []float64{0, 0.1, 0, -0.05}}},
+		{"0.25,-0.25", Groove{Swing: 50, Offsets: []float64{0.25, -0.25}}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "Swing", "fast", "0,", "0,a", "0.26", "0,-0.3", "NaN", "0,Inf"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): no error", spec)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	for _, template := range Templates {
+		if err := template.Groove.Check(); err != nil {
+			t.Errorf("%s: %v", template.Name, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		groove Groove
+		valid  bool
+	}{
+		{Groove{}, true},
+		{Groove{Swing: MinSwing}, true},
+		{Groove{Swing: MaxSwing}, true},
+		{Groove{Swing: MinSwing - 1}, false},
+		{Groove{Swing: MaxSwing + 0.5}, false},
+		{Groove{Swing: -50}, false},
+		{Groove{Swing: math.NaN()}, false},
+		{Groove{Offsets: []float64{-MaxOffset, MaxOffset}}, true},
+		{Groove{Offsets: []float64{0, MaxOffset + 0.01}}, false},
+		{Groove{Offsets: []float64{-MaxOffset - 0.01}}, false},
+		{Groove{Offsets: []float64{math.Inf(1)}}, false},
+		{Groove{Offsets: []float64{math.NaN()}}, false},
+	}
+	for _, test := range tests {
+		if err := test.groove.Check(); (err == nil) != test.valid {
+			t.Errorf("%v.Check() = %v, want valid %v", test.groove, err, test.valid)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		groove Groove
+		want   []float64
+	}{
+		{Groove{}, []float64{0, 0, 0, 0}},
+		{Groove{Swing: 50}, []float64{0, 0, 0, 0}},
+		{Groove{Swing: 75}, []float64{0, 0.5, 0, 0.5}},
+		{Groove{Swing: 60, Offsets: []float64{0.1}}, []float64{0.1, 0.3, 0.1, 0.3}},
+		{Groove{Offsets: []float64{0, 0.1, -0.1}}, []float64{0, 0.1, -0.1, 0, 0.1}},
+	}
+	for _, test := range tests {
+		for step, want := range test.want {
+			if got := test.groove.Offset(step); math.Abs(got-want) > 1e-9 {
+				t.Errorf("%v.Offset(%d) = %v, want %v", test.groove, step, got, want)
+			}
+		}
+	}
+}
+
+// TestMonotonic checks that the steps of the grooves within the limits
+// of Check never start before the previous ones, which the MIDI files
+// depend on.
+func TestMonotonic(t *testing.T) {
+	grooves := []Groove{
+		{Swing: MaxSwing, Offsets: []float64{-MaxOffset, MaxOffset}},
+		{Swing: MaxSwing, Offsets: []float64{MaxOffset, -MaxOffset}},
+		{Swing: MaxSwing, Offsets: []float64{MaxOffset, MaxOffset, -MaxOffset}},
+		{Offsets: []float64{MaxOffset, -MaxOffset}},
+	}
+	for _, template := range Templates {
+		grooves = append(grooves, template.Groove)
+	}
+	for _, g := range grooves {
+		if err := g.Check(); err != nil {
+			t.Fatal(err)
+		}
+		for step := 0; step < 12; step++ {
+			start, next := float64(step)+g.Offset(step), float64(step+1)+g.Offset(step+1)
+			if next < start {
+				t.Errorf("%v: step %d starts at %v, after step %d at %v", g, step, start, step+1, next)
+			}
+		}
+	}
+}
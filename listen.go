@@ -0,0 +1,117 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/loig/grac/sound"
+)
+
+const defaultWindowWidth = 4
+
+// toggleWindow makes only a few cells audible, or all of them again.
+func (gD *GameDisplay) toggleWindow() {
+	if len(gD.audio.window.Cells) > 0 {
+		gD.audio.window = sound.Window{}
+		return
+	}
+	if gD.audio.windowWidth <= 0 {
+		gD.audio.windowWidth = defaultWindowWidth
+	}
+	gD.audio.windowStart = (gD.automaton.Size() - gD.audio.windowWidth) / 2
+	gD.setWindow()
+}
+
+// moveWindow moves the audible cells by delta cells.
+func (gD *GameDisplay) moveWindow(delta int) {
+	if len(gD.audio.window.Cells) == 0 {
+		return
+	}
+	gD.audio.windowStart += delta
+	gD.setWindow()
+}
+
+// resizeWindow adds delta cells to the audible ones.
+func (gD *GameDisplay) resizeWindow(delta int) {
+	if len(gD.audio.window.Cells) == 0 {
+		return
+	}
+	width := gD.audio.windowWidth + delta
+	if width >= 1 && width <= gD.automaton.Size() {
+		gD.audio.windowWidth = width
+		gD.setWindow()
+	}
+}
+
+// toggleRouting makes each audible cell play its own voice, or the sound
+// of its state.
+func (gD *GameDisplay) toggleRouting() {
+	gD.audio.windowRouted = !gD.audio.windowRouted
+	if len(gD.audio.window.Cells) > 0 {
+		gD.setWindow()
+	}
+}
+
+func (gD *GameDisplay) setWindow() {
+	size := gD.automaton.Size()
+	gD.audio.windowStart = (gD.audio.windowStart%size + size) % size
+	if gD.audio.windowWidth > size {
+		gD.audio.windowWidth = size
+	}
+	gD.audio.window = sound.ContiguousWindow(gD.audio.windowStart, gD.audio.windowWidth, size, gD.audio.windowRouted, globalMaxNumVal-1)
+}
+
+// setSessionWindow sets a window that may not be contiguous.
+func (gD *GameDisplay) setSessionWindow(w sound.Window) {
+	gD.audio.window = w
+	if len(w.Cells) > 0 {
+		gD.audio.windowStart = w.Cells[0]
+		gD.audio.windowWidth = len(w.Cells)
+		gD.audio.windowRouted = len(w.Voices) > 0
+	}
+}
+
+// fitWindow moves the audible cells back on the automaton after a
+// change of its size.
+func (gD *GameDisplay) fitWindow() {
+	if gD.audio.window.Check(gD.automaton.Size(), globalMaxNumVal-1) != nil {
+		gD.setWindow()
+	}
+}
+
+func (gD *GameDisplay) windowName() string {
+	w := gD.audio.window
+	if len(w.Cells) == 0 {
+		return "toutes les cellules"
+	}
+	name := fmt.Sprint("cellule ", w.Cells[0]+1)
+	if len(w.Cells) > 1 {
+		name = fmt.Sprint("cellules ", w.Cells[0]+1, " à ", w.Cells[len(w.Cells)-1]+1)
+		for i := 1; i < len(w.Cells); i++ {
+			if w.Cells[i] != (w.Cells[i-1]+1)%gD.automaton.Size() {
+				name = fmt.Sprint(len(w.Cells), " cellules")
+				break
+			}
+		}
+	}
+	if len(w.Voices) > 0 {
+		name += ", une voix par cellule"
+	}
+	return name
+}
@@ -0,0 +1,72 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+)
+
+// stepsPerBar is the number of generations in a bar of an exported
+// loop, one generation being a quarter note.
+const stepsPerBar = 4
+
+func (gD *GameDisplay) toggleLoop() {
+	if gD.loop != nil {
+		gD.loop = nil
+		return
+	}
+	transient, period, found := gD.automaton.Cycle()
+	if !found {
+		gD.showMessage("Aucun cycle trouvé pour l'instant")
+		return
+	}
+	gD.loop, _ = gD.automaton.FindLoop(transient + period)
+	gD.restartLoop()
+}
+
+// restartLoop plays the loop from its start: from the initial grid with
+// the intro, from the first generation of the cycle without it.
+func (gD *GameDisplay) restartLoop() {
+	gD.automaton.Init()
+	if !gD.loopIntro {
+		for i := 0; i < len(gD.loop.Intro); i++ {
+			gD.automaton.Update()
+		}
+	}
+	gD.startSteps()
+}
+
+// loopStep gives the position of the current generation in the intro or
+// in the cycle of the loop.
+func (gD *GameDisplay) loopStep() string {
+	generation := gD.automaton.Generation()
+	if transient := len(gD.loop.Intro); generation < transient {
+		return fmt.Sprint("introduction, pas ", generation+1, "/", transient)
+	}
+	period := len(gD.loop.Cycle)
+	return fmt.Sprint("pas ", (generation-len(gD.loop.Intro))%period+1, "/", period)
+}
+
+// exportedGenerations returns the generations to write in exported
+// files: the loop in loop mode, the first generations otherwise.
+func (gD *GameDisplay) exportedGenerations() [][]int {
+	if gD.loop != nil {
+		return gD.loop.Bars(stepsPerBar, gD.loopIntro)
+	}
+	return gD.automaton.Generations(exportGenerations)
+}
@@ -18,7 +18,17 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/loig/grac/automaton"
+	"github.com/loig/grac/groove"
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/osc"
+	"github.com/loig/grac/sound"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -26,13 +36,32 @@ import (
 )
 
 type GameDisplay struct {
-	state     int
-	automaton CelAut
-	tempoPos  int
-	frame     int
-	fresh     bool
-	part      bool
-	audio     soundManager
+	state        int
+	automaton    *automaton.CelAut
+	tempo        float64
+	groove       groove.Groove
+	groovePos    int
+	frame        int
+	fresh        bool
+	part         bool
+	audio        soundManager
+	message      string
+	messageFrame int
+	sessionFile  string
+	loop         *automaton.Loop
+	loopIntro    bool
+	// savedRules are the rules, for savedNumVal states and radius
+	// savedRadius, when the number of states started to change: they are
+	// converted again at each change so that going through fewer states
+	// or a smaller radius and back does not lose them
+	savedRules  []int
+	savedNumVal int
+	savedRadius int
+	// osc receives remote commands and sends the generations, if not nil
+	osc *osc.Server
+	// mutex protects the display from the audio scheduler, which steps
+	// the automaton
+	mutex sync.Mutex
 }
 
 const (
@@ -43,6 +72,7 @@ const (
 	stateChooseRules
 	stateChooseInitial
 	stateRunAutomaton
+	stateMixer
 )
 
 func (gD *GameDisplay) initUpdate() bool {
@@ -56,13 +86,30 @@ func (gD *GameDisplay) initUpdate() bool {
 }
 
 func (gD *GameDisplay) Update() error {
+	gD.mutex.Lock()
+	defer gD.mutex.Unlock()
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
 		gD.part = !gD.part
 	}
+	if gD.messageFrame > 0 {
+		gD.messageFrame--
+	}
+	if gD.state >= stateChooseTempo && !typingRuleCode {
+		if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+			gD.saveSession()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+			gD.loadSession()
+		}
+	}
 	switch gD.state {
 	case stateInit:
 		if gD.initUpdate() {
 			gD.state++
+			if !gD.fresh {
+				gD.state = stateChooseRules
+			}
 		}
 	case stateChooseTempo:
 		if gD.chooseTempoUpdate() {
@@ -71,57 +118,101 @@ func (gD *GameDisplay) Update() error {
 	case stateChooseSize:
 		if gD.chooseSizeUpdate() {
 			gD.state++
-			gD.automaton.keepOldRules = false
+			gD.saveRules()
+			gD.fitWindow()
 		}
-		gD.automaton.genGrid(gD.fresh)
 	case stateChooseNumVal:
 		if gD.chooseNumValUpdate() {
 			currentRule = 0
 			gD.state++
 		}
-		gD.automaton.genBasicRules(gD.fresh)
 	case stateChooseRules:
+		typing := typingRuleCode
 		if gD.chooseRulesUpdate() {
 			currentCell = 0
 			gD.state++
-		} else if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-			gD.automaton.init()
-			gD.playSounds()
-			gD.frame = 0
+		} else if !typing && inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+			gD.automaton.Init()
 			gD.state += 2
+			gD.startSteps()
 		}
-		gD.automaton.init()
+		gD.automaton.Init()
 	case stateChooseInitial:
 		if gD.chooseInitialGridUpdate() {
-			gD.playSounds()
-			gD.frame = 0
 			gD.state++
+			gD.startSteps()
 		} else if inpututil.IsKeyJustPressed(ebiten.KeyShift) {
 			gD.state--
 		}
-		gD.automaton.init()
+		gD.automaton.Init()
+	case stateMixer:
+		if gD.mixerUpdate() {
+			gD.state = stateRunAutomaton
+		}
 	case stateRunAutomaton:
-		gD.frame++
-		if 3600/tempos[gD.tempoPos] <= gD.frame {
-			gD.automaton.update()
-			gD.playSounds()
-			gD.frame = 0
+		if inpututil.IsKeyJustPressed(ebiten.KeyX) {
+			gD.state = stateMixer
 		}
 		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
 			gD.fresh = false
-			gD.automaton.genGrid(gD.fresh)
+			gD.loop = nil
+			gD.automaton.Init()
 			gD.state = stateChooseTempo
 		}
 		if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
 			if !gD.audio.use {
 				gD.audio.use = true
 			} else {
-				gD.audio.soundset = (gD.audio.soundset + 1) % numSoundSet
+				gD.audio.soundset = (gD.audio.soundset + 1) % len(sounds)
 				if gD.audio.soundset == 0 {
 					gD.audio.use = false
 				}
 			}
 		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+			gD.exportMIDI()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyW) {
+			gD.exportWAV()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+			gD.toggleLoop()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+			gD.loopIntro = !gD.loopIntro
+			if gD.loop != nil {
+				gD.restartLoop()
+			}
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+			gD.cyclePitchMode()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+			gD.tapTempo()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyO) {
+			gD.cycleGroove()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+			gD.changeSwing(1)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+			gD.changeSwing(-1)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyG) && gD.audio.pitch.Mode != sound.NoPitch {
+			gD.cycleScale()
+		}
+	}
+
+	if gD.state < stateRunAutomaton {
+		gD.audio.scheduler.Stop()
+		gD.stopMIDI()
+		if gD.audio.leader != nil {
+			gD.audio.leader.Stop()
+		}
+	} else if gD.audio.use {
+		// computed here rather than when the scheduler needs them
+		gD.cellSounds()
 	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
@@ -131,17 +222,36 @@ func (gD *GameDisplay) Update() error {
 }
 
 func (gD *GameDisplay) Draw(screen *ebiten.Image) {
+	gD.mutex.Lock()
+	defer gD.mutex.Unlock()
+
 	if gD.state >= stateChooseTempo {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Tempo : ", tempos[gD.tempoPos]), 10, 10)
+		if typedTempo != "" {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Tempo : ", typedTempo, "_"), 10, 10)
+		} else {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Tempo : ", formatTempo(gD.tempo)), 10, 10)
+		}
+		if gD.audio.midiOut == nil && gD.audio.following {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("MIDI", gD.clockName()), 280, 10)
+		}
+		if gD.audio.midiOut != nil {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Sortie MIDI : ", gD.audio.midiOut.Name(), gD.clockName()), 280, 10)
+		}
 		if gD.state == stateChooseTempo {
 			ebitenutil.DebugPrintAt(screen, "Réglage du tempo", 10, 490)
-			ebitenutil.DebugPrintAt(screen, "   Flèches : faire varier le tempo", 10, 505)
-			ebitenutil.DebugPrintAt(screen, "   Entrée : valider le tempo", 10, 520)
+			ebitenutil.DebugPrintAt(screen, "   Flèches haut et bas : faire varier le tempo de 1", 10, 505)
+			ebitenutil.DebugPrintAt(screen, "   Flèches gauche et droite : faire varier le tempo de 10", 10, 520)
+			ebitenutil.DebugPrintAt(screen, "   Chiffres : saisir un tempo, T : le taper en rythme", 10, 535)
+			ebitenutil.DebugPrintAt(screen, "   Entrée : valider le tempo", 10, 550)
 		}
 	}
 
 	if gD.state >= stateChooseSize || !gD.fresh {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Nombre de cellules : ", gD.automaton.size), 10, 25)
+		boundary := boundaryNames[gD.automaton.Boundary()]
+		if gD.automaton.Boundary() == automaton.Fixed {
+			boundary = fmt.Sprint(boundary, gD.automaton.BoundaryValue())
+		}
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Nombre de cellules : ", gD.automaton.Size(), " (", boundary, ")"), 10, 25)
 		if gD.state == stateChooseSize {
 			ebitenutil.DebugPrintAt(screen, "Réglage du nombre de cellules", 10, 490)
 			ebitenutil.DebugPrintAt(screen, "   Flèches : faire varier le nombre de cellules", 10, 505)
@@ -150,33 +260,51 @@ func (gD *GameDisplay) Draw(screen *ebiten.Image) {
 	}
 
 	if gD.state >= stateChooseNumVal || !gD.fresh {
-		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Nombre d'états par cellule : ", gD.automaton.numVal), 10, 40)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Nombre d'états par cellule : ", gD.automaton.NumVal(), ", rayon du voisinage : ", gD.automaton.Radius()), 10, 40)
 		if gD.state == stateChooseNumVal {
 			ebitenutil.DebugPrintAt(screen, "Réglage du nombre d'états possibles pour chaque cellule", 10, 490)
 			ebitenutil.DebugPrintAt(screen, "   Flèches : faire varier le nombre d'états", 10, 505)
 			ebitenutil.DebugPrintAt(screen, "   Entrée : valider le nombre d'états", 10, 520)
+			if gD.automaton.NumVal() == 2 {
+				ebitenutil.DebugPrintAt(screen, "   R : changer le rayon du voisinage", 280, 505)
+			}
 		}
 	}
 
 	if gD.state >= stateChooseNumVal || !gD.fresh {
-		ebitenutil.DebugPrintAt(screen, "Règles : ", 10, 55)
+		if typingRuleCode {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Règles", familyNames[gD.automaton.Family()], " : n° ", typedRuleCode, "_"), 10, 55)
+		} else {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Règles", familyNames[gD.automaton.Family()], " : n° ", gD.automaton.RuleCode()), 10, 55)
+		}
 		if gD.state == stateChooseRules {
-			gD.automaton.drawRules(screen, 20, 75, true)
-			ebitenutil.DebugPrintAt(screen, "Choix des règles", 10, 490)
-			ebitenutil.DebugPrintAt(screen, "   Flèches : sélectionner une règle", 10, 505)
-			ebitenutil.DebugPrintAt(screen, "   Espace : changer la règle sélectionnée", 10, 520)
-			ebitenutil.DebugPrintAt(screen, "   Majuscule : passer au choix de l'état initial", 10, 535)
-			ebitenutil.DebugPrintAt(screen, "   Entrée : lancer la simulation", 10, 550)
+			drawRules(gD.automaton, screen, rulesX, rulesY, true)
+			if typingRuleCode {
+				ebitenutil.DebugPrintAt(screen, "Saisie du numéro de la règle", 10, 490)
+				ebitenutil.DebugPrintAt(screen, "   Chiffres : taper le numéro", 10, 505)
+				ebitenutil.DebugPrintAt(screen, "   Retour arrière : effacer un chiffre", 10, 520)
+				ebitenutil.DebugPrintAt(screen, "   N : annuler la saisie", 10, 535)
+				ebitenutil.DebugPrintAt(screen, "   Entrée : valider le numéro", 10, 550)
+			} else {
+				ebitenutil.DebugPrintAt(screen, "Choix des règles", 10, 490)
+				ebitenutil.DebugPrintAt(screen, "   Flèches : sélectionner une règle", 10, 505)
+				ebitenutil.DebugPrintAt(screen, "   Espace : changer la règle sélectionnée", 10, 520)
+				ebitenutil.DebugPrintAt(screen, "   Majuscule : passer au choix de l'état initial", 10, 535)
+				ebitenutil.DebugPrintAt(screen, "   Entrée : lancer la simulation", 10, 550)
+				ebitenutil.DebugPrintAt(screen, "   N : saisir le numéro de la règle", 280, 505)
+				ebitenutil.DebugPrintAt(screen, "   F : changer de famille de règles", 280, 520)
+				ebitenutil.DebugPrintAt(screen, "   Clic : changer une règle, clic droit : revenir en arrière", 280, 490)
+			}
 		} else {
-			gD.automaton.drawRules(screen, 20, 75, false)
+			drawRules(gD.automaton, screen, rulesX, rulesY, false)
 		}
 	}
 
-	if gD.state != stateRunAutomaton && (gD.state >= stateChooseSize || !gD.fresh) {
+	if gD.state < stateRunAutomaton && (gD.state >= stateChooseSize || !gD.fresh) {
 		if gD.part {
-			gD.automaton.drawPart(screen, 350+(globalMaxSize-len(gD.automaton.grid))*8, 20, gD.state == stateChooseInitial, gD.state >= stateChooseRules)
+			drawPart(gD.automaton, gD.audio.window, screen, partX(gD.automaton), partY, gD.state == stateChooseInitial, gD.state >= stateChooseRules)
 		} else {
-			gD.automaton.draw(screen, 700, 300, gD.state == stateChooseInitial, gD.state >= stateChooseRules)
+			drawAutomaton(gD.automaton, gD.audio.window, screen, automatonX, automatonY, gD.state == stateChooseInitial, gD.state >= stateChooseRules)
 		}
 		if gD.state == stateChooseInitial {
 			ebitenutil.DebugPrintAt(screen, "Choix de l'état initial des cellules", 10, 490)
@@ -184,26 +312,79 @@ func (gD *GameDisplay) Draw(screen *ebiten.Image) {
 			ebitenutil.DebugPrintAt(screen, "   Espace : changer l'état de la cellule sélectionnée", 10, 520)
 			ebitenutil.DebugPrintAt(screen, "   Majuscule : passer au choix des règles", 10, 535)
 			ebitenutil.DebugPrintAt(screen, "   Entrée : lancer la simulation", 10, 550)
+			ebitenutil.DebugPrintAt(screen, "   Clic : changer une cellule, clic droit : revenir en arrière", 280, 490)
+			ebitenutil.DebugPrintAt(screen, "   B : changer le type de bords", 280, 535)
+			if gD.automaton.Boundary() == automaton.Fixed {
+				ebitenutil.DebugPrintAt(screen, "   V : changer l'état des bords", 280, 550)
+			}
 		}
 	}
 
-	if gD.state == stateRunAutomaton {
+	if gD.state >= stateRunAutomaton {
 		if gD.part {
-			gD.automaton.drawPart(screen, 350+(globalMaxSize-len(gD.automaton.grid))*8, 20, false, true)
+			drawPart(gD.automaton, gD.audio.window, screen, partX(gD.automaton), partY, false, true)
+		} else {
+			drawAutomaton(gD.automaton, gD.audio.window, screen, automatonX, automatonY, false, true)
+		}
+	}
+
+	if gD.state == stateMixer {
+		gD.drawMixer(screen)
+	}
+
+	if gD.state == stateRunAutomaton {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Simulation en cours (génération ", gD.automaton.Generation(), ")"), 10, 490)
+		if transient, period, found := gD.automaton.Cycle(); found {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Cycle de ", generations(period), " après ", generations(transient)), 330, 490)
+		}
+		if gD.loop != nil {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("Boucle : ", gD.loopStep()), 330, 475)
+		}
+		loopHelp := "   B : jouer le cycle en boucle"
+		if gD.loop != nil {
+			loopHelp = "   B : quitter la boucle"
+		}
+		if gD.loopIntro {
+			loopHelp += ", I : sans introduction"
 		} else {
-			gD.automaton.draw(screen, 700, 300, false, true)
+			loopHelp += ", I : avec introduction"
+		}
+		ebitenutil.DebugPrintAt(screen, loopHelp, 330, 505)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("   P : hauteur des sons selon les cellules (", pitchNames[gD.audio.pitch.Mode], ")"), 330, 520)
+		if gD.audio.pitch.Mode != sound.NoPitch {
+			ebitenutil.DebugPrintAt(screen, fmt.Sprint("   G : changer de gamme (", scaleNames[gD.audio.scalePos], ")"), 330, 535)
 		}
-		ebitenutil.DebugPrintAt(screen, fmt.Sprint("Simulation en cours (génération ", gD.automaton.generation, ")"), 10, 490)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("   O, gauche, droite : groove (", gD.grooveName(), ")"), 330, 550)
 		ebitenutil.DebugPrintAt(screen, "   Entrée : recommencer avec de nouveaux paramètres", 10, 505)
 		if !gD.audio.use {
 			ebitenutil.DebugPrintAt(screen, "   Espace : utiliser des sons", 10, 520)
 		} else {
-			if gD.audio.soundset+1 == numSoundSet {
+			if gD.audio.soundset+1 == len(sounds) {
 				ebitenutil.DebugPrintAt(screen, "   Espace : couper les sons", 10, 520)
 			} else {
 				ebitenutil.DebugPrintAt(screen, "   Espace : changer le jeu de sons", 10, 520)
 			}
 		}
+		exported := fmt.Sprint(exportGenerations, " générations")
+		if gD.loop != nil {
+			exported = "la boucle"
+		}
+		ebitenutil.DebugPrintAt(screen, fmt.Sprint("   M, W : enregistrer ", exported, " (MIDI, WAV)"), 10, 535)
+		ebitenutil.DebugPrintAt(screen, "   T : taper le tempo, X : table de mixage", 10, 550)
+	}
+
+	if gD.messageFrame > 0 {
+		ebitenutil.DebugPrintAt(screen, gD.message, 10, 470)
+	}
+
+	if gD.state == stateMixer {
+		// the help of the mixer takes the whole bottom of the screen
+		return
+	}
+
+	if gD.state >= stateChooseTempo {
+		ebitenutil.DebugPrintAt(screen, "   S : enregistrer la session", 280, 565)
+		ebitenutil.DebugPrintAt(screen, "   L : charger la session", 280, 580)
 	}
 
 	if gD.part {
@@ -224,12 +405,95 @@ func (gD *GameDisplay) Layout(width, height int) (int, int) {
 
 func main() {
 
+	load := flag.String("load", "", "session à charger au démarrage")
+	soundDir := flag.String("sounds", defaultSoundDir, "dossier des jeux de sons supplémentaires, un sous-dossier par jeu")
+	synth := flag.String("synth", "", "sons synthétisés, instrument:hauteur:durée pour chaque état séparés par des virgules (instruments : kick, snare, hihat, clap, tone)")
+	scale := flag.String("scale", "", "gamme personnalisée jouée par les cellules, liste de demi-tons comme 0,3,5,7,10")
+	midiOut := flag.String("midi-out", "", "port MIDI où jouer les générations, par exemple /dev/snd/midiC1D0, ou auto pour le premier port trouvé")
+	midiNotes := flag.String("midi-notes", "10:36,10:38,10:42,10:46", "canal (1 à 16) et note joués par chaque état sur le port MIDI, séparés par des virgules")
+	midiClock := flag.String("midi-clock", "", "horloge MIDI : lead pour l'envoyer sur le port de sortie, follow pour suivre celle du port -midi-in")
+	midiIn := flag.String("midi-in", "auto", "port MIDI dont l'horloge est suivie avec -midi-clock follow (auto pour le premier port trouvé)")
+	oscAddr := flag.String("osc", "", "adresse UDP du serveur OSC, par exemple :9000")
+	oscSend := flag.String("osc-send", "", "adresses UDP où envoyer les générations par OSC, séparées par des virgules, par exemple localhost:9001")
+	flag.Parse()
+
+	voices := sound.DefaultVoices
+	if *synth != "" {
+		var err error
+		voices, err = sound.ParseVoices(*synth)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *scale != "" {
+		steps, err := sound.ParseScale(*scale)
+		if err != nil {
+			log.Fatal(err)
+		}
+		addScale(steps)
+	}
+
 	gD := GameDisplay{
-		state:     0,
-		automaton: initCellularAutomaton(),
-		tempoPos:  25,
-		fresh:     true,
-		audio:     initAudio(),
+		state:       0,
+		automaton:   automaton.New(),
+		tempo:       globalDefaultTempo,
+		fresh:       true,
+		audio:       initAudio(*soundDir, voices),
+		sessionFile: defaultSessionFile,
+	}
+
+	gD.startScheduler()
+
+	if *midiOut != "" {
+		stateNotes, err := midi.ParseStateNotes(*midiNotes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := gD.openMIDI(*midiOut, stateNotes); err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			gD.mutex.Lock()
+			defer gD.mutex.Unlock()
+			gD.releaseMIDI()
+		}()
+	}
+	if *oscAddr != "" || *oscSend != "" {
+		var targets []string
+		if *oscSend != "" {
+			targets = strings.Split(*oscSend, ",")
+		}
+		if *oscAddr == "" {
+			// only sends the generations, from any port
+			*oscAddr = ":0"
+		}
+		if err := gD.listenOSC(*oscAddr, targets); err != nil {
+			log.Fatal(err)
+		}
+		defer gD.osc.Close()
+	}
+
+	switch *midiClock {
+	case "":
+	case "lead":
+		if gD.audio.midiOut == nil {
+			log.Fatal("-midi-clock lead demande un port de sortie -midi-out")
+		}
+		gD.leadClock()
+	case "follow":
+		if err := gD.followClock(*midiIn); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("%q n'est pas une horloge MIDI valide (lead ou follow)", *midiClock)
+	}
+
+	if *load != "" {
+		gD.sessionFile = *load
+		if err := gD.applySessionFile(); err != nil {
+			log.Fatal(err)
+		}
+		gD.state = stateInit
 	}
 
 	ebiten.SetWindowSize(1000, 600)
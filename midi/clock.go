@@ -0,0 +1,241 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package midi
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ClocksPerStep is the number of MIDI clock messages per step, one step
+// lasting one quarter note.
+const ClocksPerStep = 24
+
+// MIDI real-time messages.
+const (
+	msgClock    = 0xF8
+	msgStart    = 0xFA
+	msgContinue = 0xFB
+	msgStop     = 0xFC
+)
+
+// Send writes the bytes of a message to the port.
+func (p *Port) Send(data ...byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.write(data)
+}
+
+// Leader sends MIDI clock to a port, so that other devices play in time
+// with grac. The clock messages are sent along with the steps given to
+// Step, so that they follow the same time base.
+type Leader struct {
+	port *Port
+	mu   sync.Mutex
+	// ticks are the times of the clock messages still to send, the first
+	// one following a start message if starting
+	ticks    []time.Time
+	starting bool
+	running  bool
+	wake     chan struct{}
+	stop     chan struct{}
+	// err is the error that stopped the clock, until Err returns it
+	err error
+}
+
+// NewLeader returns a stopped leader sending its clock to port.
+func NewLeader(port *Port) *Leader {
+	return &Leader{port: port}
+}
+
+// Start starts the clock, with a start message sent at the first step
+// given to Step.
+func (l *Leader) Start() error {
+	if err := l.Stop(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ticks = l.ticks[:0]
+	l.starting = true
+	l.running = true
+	l.wake = make(chan struct{}, 1)
+	l.stop = make(chan struct{})
+	go l.run(l.wake, l.stop)
+	return nil
+}
+
+// Step sends the ClocksPerStep clock messages of a step starting at
+// beat, without groove, and lasting length. The messages of the
+// previous step that are not sent yet are sent at beat at the latest,
+// so that the other devices count the right number of steps.
+func (l *Leader) Step(beat time.Time, length time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running {
+		return
+	}
+	for i, at := range l.ticks {
+		if at.After(beat) {
+			l.ticks[i] = beat
+		}
+	}
+	for i := 0; i < ClocksPerStep; i++ {
+		l.ticks = append(l.ticks, beat.Add(length*time.Duration(i)/ClocksPerStep))
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop sends a stop message, if the clock is running.
+func (l *Leader) Stop() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running {
+		return nil
+	}
+	l.running = false
+	close(l.stop)
+	if l.starting {
+		// nothing was sent yet
+		return nil
+	}
+	return l.port.Send(msgStop)
+}
+
+// Err returns the error of the port that stopped the clock since the
+// last call, if any. The clock stays stopped until the next Start.
+func (l *Leader) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	l.err = nil
+	return err
+}
+
+// run sends the clock messages at their time, woken up by Step, until
+// the clock is stopped or the port fails.
+func (l *Leader) run(wake, stop chan struct{}) {
+	for {
+		var timer <-chan time.Time
+		l.mu.Lock()
+		if len(l.ticks) > 0 {
+			timer = time.After(time.Until(l.ticks[0]))
+		}
+		l.mu.Unlock()
+		select {
+		case <-stop:
+			return
+		case <-wake:
+			continue
+		case <-timer:
+		}
+		l.mu.Lock()
+		if l.stop != stop {
+			l.mu.Unlock()
+			return
+		}
+		if len(l.ticks) == 0 || time.Now().Before(l.ticks[0]) {
+			l.mu.Unlock()
+			continue
+		}
+		l.ticks = l.ticks[1:]
+		var err error
+		if l.starting {
+			l.starting = false
+			err = l.port.Send(msgStart, msgClock)
+		} else {
+			err = l.port.Send(msgClock)
+		}
+		if err != nil {
+			l.running = false
+			l.ticks = l.ticks[:0]
+			l.err = err
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+	}
+}
+
+// ClockEvent is an event of the MIDI clock of another device.
+type ClockEvent int
+
+const (
+	// ClockStart asks to play from the start, at the next ClockStep.
+	ClockStart ClockEvent = iota
+	// ClockContinue asks to play again from where it stopped.
+	ClockContinue
+	// ClockStop asks to stop playing.
+	ClockStop
+	// ClockStep marks the start of a step, every ClocksPerStep clock
+	// messages from the start.
+	ClockStep
+)
+
+// Follow reads MIDI messages from r until it fails, and calls event for
+// each clock event with the tempo measured from the clock messages, 0
+// while unknown.
+func Follow(r io.Reader, event func(e ClockEvent, tempo float64)) error {
+	buf := make([]byte, 256)
+	var ticks []time.Time
+	count := 0
+	for {
+		n, err := r.Read(buf)
+		now := time.Now()
+		for _, b := range buf[:n] {
+			switch b {
+			case msgStart:
+				count = 0
+				event(ClockStart, measuredTempo(ticks))
+			case msgContinue:
+				event(ClockContinue, measuredTempo(ticks))
+			case msgStop:
+				event(ClockStop, measuredTempo(ticks))
+			case msgClock:
+				ticks = append(ticks, now)
+				if len(ticks) > ClocksPerStep+1 {
+					ticks = ticks[1:]
+				}
+				if count%ClocksPerStep == 0 {
+					event(ClockStep, measuredTempo(ticks))
+				}
+				count++
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// measuredTempo returns the tempo, in steps per minute, given by the
+// times of the last clock messages.
+func measuredTempo(ticks []time.Time) float64 {
+	if len(ticks) < 2 {
+		return 0
+	}
+	elapsed := ticks[len(ticks)-1].Sub(ticks[0]).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return 60 * float64(len(ticks)-1) / (elapsed * ClocksPerStep)
+}
@@ -0,0 +1,103 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package midi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingWriter fails the first writes, then records the written bytes.
+type failingWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []byte
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return 0, errors.New("port closed")
+	}
+	w.written = append(w.written, data...)
+	return len(data), nil
+}
+
+func (w *failingWriter) Close() error {
+	return nil
+}
+
+// waitErr waits for the error that stops l.
+func waitErr(t *testing.T, l *Leader) error {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if err := l.Err(); err != nil {
+			return err
+		}
+	}
+	t.Fatal("no error")
+	return nil
+}
+
+func TestLeaderError(t *testing.T) {
+	w := &failingWriter{failures: 1}
+	l := NewLeader(NewPort(w, "test"))
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	l.Step(time.Now(), 10*time.Millisecond)
+	waitErr(t, l)
+	if err := l.Err(); err != nil {
+		t.Errorf("error returned twice: %v", err)
+	}
+	l.mu.Lock()
+	running, ticks := l.running, len(l.ticks)
+	l.mu.Unlock()
+	if running || ticks != 0 {
+		t.Errorf("running %v with %d ticks after an error", running, ticks)
+	}
+	l.Step(time.Now(), 10*time.Millisecond)
+	if err := l.Stop(); err != nil {
+		t.Errorf("Stop after an error: %v", err)
+	}
+
+	// the clock starts again once the port works
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	l.Step(time.Now(), 0)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		w.mu.Lock()
+		n := len(w.written)
+		w.mu.Unlock()
+		if n >= ClocksPerStep+1 {
+			break
+		}
+	}
+	if err := l.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.written) != ClocksPerStep+2 || w.written[0] != msgStart || w.written[len(w.written)-1] != msgStop {
+		t.Errorf("wrote % X", w.written)
+	}
+}
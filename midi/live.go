@@ -0,0 +1,240 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package midi
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateNote is the channel, from 0, and the note played by the cells in
+// a state.
+type StateNote struct {
+	Channel int
+	Note    int
+}
+
+// DefaultStateNotes play a drum kit: bass drum, snare drum, closed and
+// open hi-hat.
+var DefaultStateNotes []StateNote = []StateNote{
+	{DrumChannel, 36}, {DrumChannel, 38}, {DrumChannel, 42}, {DrumChannel, 46},
+}
+
+// ParseStateNotes reads the channel and the note of each non-zero
+// state, such as "10:36,10:38,1:60", channels being numbered from 1.
+func ParseStateNotes(s string) ([]StateNote, error) {
+	var res []StateNote
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("midi: %q is not channel:note", item)
+		}
+		channel, err1 := strconv.Atoi(parts[0])
+		note, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || channel < 1 || channel > 16 || note < 0 || note > 127 {
+			return nil, fmt.Errorf("midi: invalid channel or note in %q", item)
+		}
+		res = append(res, StateNote{channel - 1, note})
+	}
+	return res, nil
+}
+
+// Note is a note played by a step.
+type Note struct {
+	Channel  int
+	Note     int
+	Velocity int
+}
+
+// StepNotes returns the notes played by grid, cell i in state s playing
+// stateNotes[s-1] transposed by transpose(i, s) semitones at velocity
+// 100 multiplied by velocities[i], cells playing the same note giving a
+// single one. Without velocities, cells are played at velocity 100, and
+// transpose may be nil.
+func StepNotes(grid []int, stateNotes []StateNote, velocities []float64, transpose func(cell, state int) int) []Note {
+	var res []Note
+	for cell, state := range grid {
+		if state == 0 || state > len(stateNotes) {
+			continue
+		}
+		n := Note{stateNotes[state-1].Channel, stateNotes[state-1].Note, 100}
+		if transpose != nil {
+			n.Note += transpose(cell, state)
+		}
+		if cell < len(velocities) {
+			n.Velocity = int(math.Round(100 * velocities[cell]))
+		}
+		if n.Note < 0 || n.Note > 127 || n.Velocity <= 0 {
+			continue
+		}
+		if n.Velocity > 127 {
+			n.Velocity = 127
+		}
+		res = addNote(res, n)
+	}
+	return res
+}
+
+// addNote adds n to notes, or raises the velocity of the same note
+// already played by another cell.
+func addNote(notes []Note, n Note) []Note {
+	for i, m := range notes {
+		if m.Channel == n.Channel && m.Note == n.Note {
+			if n.Velocity > m.Velocity {
+				notes[i].Velocity = n.Velocity
+			}
+			return notes
+		}
+	}
+	return append(notes, n)
+}
+
+// Port sends MIDI messages as soon as they are written, to a device such
+// as an ALSA raw MIDI port.
+type Port struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	name    string
+	playing []Note
+	// delayed counts the calls to Stop, which cancel the notes waiting
+	// to be played by PlayAt, and delayedErr is the first error of these
+	// notes
+	delayed    int
+	delayedErr error
+}
+
+// Ports returns the ALSA raw MIDI devices. The ports of the virtual
+// MIDI driver (module snd-virmidi) are also ports of the ALSA sequencer,
+// which other programs can connect to.
+func Ports() []string {
+	names, _ := filepath.Glob("/dev/snd/midiC*D*")
+	return names
+}
+
+// OpenPort opens the named device, or file, for writing.
+func OpenPort(name string) (*Port, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewPort(file, name), nil
+}
+
+// NewPort returns a port writing to w.
+func NewPort(w io.WriteCloser, name string) *Port {
+	return &Port{w: w, name: name}
+}
+
+// Name returns the name of the port.
+func (p *Port) Name() string {
+	return p.name
+}
+
+// Play stops the notes of the previous step and starts notes, which
+// play until the next call to Play or Stop.
+func (p *Port) Play(notes []Note) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.play(notes)
+}
+
+func (p *Port) play(notes []Note) error {
+	data := p.noteOffs()
+	for _, n := range notes {
+		if isPlayingNote(p.playing, n) {
+			continue
+		}
+		data = append(data, 0x90|byte(n.Channel), byte(n.Note), byte(n.Velocity))
+		p.playing = append(p.playing, n)
+	}
+	return p.write(data)
+}
+
+// PlayAt plays notes as Play, at time at. It returns the error of the
+// notes previously played by PlayAt, if any.
+func (p *Port) PlayAt(notes []Note, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.delayedErr != nil {
+		return p.delayedErr
+	}
+	delayed := p.delayed
+	time.AfterFunc(time.Until(at), func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.delayed != delayed {
+			// stopped since the call to PlayAt
+			return
+		}
+		if err := p.play(notes); err != nil && p.delayedErr == nil {
+			p.delayedErr = err
+		}
+	})
+	return nil
+}
+
+// Stop stops the playing notes, and those waiting to be played by
+// PlayAt.
+func (p *Port) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delayed++
+	return p.write(p.noteOffs())
+}
+
+// Close stops the playing notes and closes the port.
+func (p *Port) Close() error {
+	err := p.Stop()
+	if closeErr := p.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (p *Port) noteOffs() []byte {
+	var data []byte
+	for _, n := range p.playing {
+		data = append(data, 0x80|byte(n.Channel), byte(n.Note), 0)
+	}
+	p.playing = p.playing[:0]
+	return data
+}
+
+func (p *Port) write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := p.w.Write(data)
+	return err
+}
+
+func isPlayingNote(playing []Note, n Note) bool {
+	for _, m := range playing {
+		if m.Channel == n.Channel && m.Note == n.Note {
+			return true
+		}
+	}
+	return false
+}
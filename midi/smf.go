@@ -0,0 +1,267 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package midi turns the generations of a GRAC automaton into MIDI data.
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/loig/grac/groove"
+)
+
+// Division is the number of ticks per quarter note in the files
+// written by WriteSMF. One step of the automaton lasts one quarter note.
+const Division = 480
+
+// MinTempo is the slowest tempo of the files written by WriteSMF, in
+// steps per minute, as a quarter note lasts at most 0xFFFFFF
+// microseconds in a Standard MIDI File.
+const MinTempo = 60000000.0 / 0xFFFFFF
+
+// DrumChannel is the General MIDI percussion channel (channel 10).
+const DrumChannel = 9
+
+// Mapping tells how the cells of the automaton are turned into notes.
+type Mapping int
+
+const (
+	// MapTracks gives each cell its own track. The state of the cell
+	// gives the note and the velocity.
+	MapTracks Mapping = iota
+	// MapDrums puts all the cells on a single drum track. Each cell plays
+	// its own drum note and its state gives the velocity.
+	MapDrums
+)
+
+var defaultNotes []int = []int{60, 64, 67, 72}
+
+var defaultVelocities []int = []int{64, 88, 108, 127}
+
+// General MIDI percussion notes, used in turn by the cells.
+var defaultDrumNotes []int = []int{36, 38, 42, 46, 39, 45, 48, 50, 49, 51, 37, 56}
+
+// Options describe how to write the generations of an automaton.
+type Options struct {
+	// Tempo is the number of steps per minute.
+	Tempo   float64
+	Mapping Mapping
+	// Notes and Velocities give the note and velocity of each non-zero
+	// state (Notes[0] for state 1). Notes are not used with MapDrums.
+	Notes      []int
+	Velocities []int
+	// DrumNotes gives the note of each cell with MapDrums, cells beyond
+	// its length reuse it from the start.
+	DrumNotes []int
+	// Groove shifts the start of the steps.
+	Groove groove.Groove
+	// Accents multiply the velocity of each cell at each step, none
+	// meaning 1.
+	Accents [][]float64
+}
+
+type event struct {
+	tick int
+	data []byte
+}
+
+// WriteSMF writes generations, one grid per step, as a Standard MIDI
+// File of format 1. The first track only holds the tempo.
+func WriteSMF(w io.Writer, generations [][]int, opts Options) error {
+	if opts.Tempo <= 0 {
+		return fmt.Errorf("midi: invalid tempo %v", opts.Tempo)
+	}
+	if opts.Tempo < MinTempo {
+		return fmt.Errorf("midi: tempo %v is too slow", opts.Tempo)
+	}
+	if err := opts.Groove.Check(); err != nil {
+		return err
+	}
+	if opts.Notes == nil {
+		opts.Notes = defaultNotes
+	}
+	if opts.Velocities == nil {
+		opts.Velocities = defaultVelocities
+	}
+	if opts.DrumNotes == nil {
+		opts.DrumNotes = defaultDrumNotes
+	}
+
+	numCells := 0
+	if len(generations) > 0 {
+		numCells = len(generations[0])
+	}
+	endTick := len(generations) * Division
+
+	microPerQuarter := int(math.Round(60000000 / opts.Tempo))
+	tracks := [][]event{{
+		{0, []byte{0xFF, 0x58, 0x04, 0x04, 0x02, 0x18, 0x08}},
+		{0, []byte{0xFF, 0x51, 0x03, byte(microPerQuarter >> 16), byte(microPerQuarter >> 8), byte(microPerQuarter)}},
+	}}
+
+	switch opts.Mapping {
+	case MapTracks:
+		for cell := 0; cell < numCells; cell++ {
+			track, err := noteTrack(fmt.Sprint("Cellule ", cell+1), 0, generations, opts, []int{cell},
+				func(cell, state int) (int, int, error) {
+					return stateNote(opts, state)
+				})
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, track)
+		}
+	case MapDrums:
+		cells := make([]int, numCells)
+		for i := range cells {
+			cells[i] = i
+		}
+		track, err := noteTrack("Percussions", DrumChannel, generations, opts, cells,
+			func(cell, state int) (int, int, error) {
+				_, velocity, err := stateNote(opts, state)
+				return opts.DrumNotes[cell%len(opts.DrumNotes)], velocity, err
+			})
+		if err != nil {
+			return err
+		}
+		tracks = append(tracks, track)
+	default:
+		return fmt.Errorf("midi: unknown mapping %d", opts.Mapping)
+	}
+
+	var header [14]byte
+	copy(header[:], "MThd")
+	binary.BigEndian.PutUint32(header[4:], 6)
+	binary.BigEndian.PutUint16(header[8:], 1)
+	binary.BigEndian.PutUint16(header[10:], uint16(len(tracks)))
+	binary.BigEndian.PutUint16(header[12:], Division)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		if err := writeTrack(w, track, endTick); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stateNote(opts Options, state int) (note, velocity int, err error) {
+	if state > len(opts.Velocities) || (opts.Mapping == MapTracks && state > len(opts.Notes)) {
+		return 0, 0, fmt.Errorf("midi: no note for state %d", state)
+	}
+	if opts.Mapping == MapTracks {
+		note = opts.Notes[state-1]
+	}
+	return note, opts.Velocities[state-1], nil
+}
+
+func trackName(name string) event {
+	data := []byte{0xFF, 0x03}
+	data = appendVarLen(data, len(name))
+	return event{0, append(data, name...)}
+}
+
+// noteTrack builds a track where each active cell among cells plays
+// the note given by noteOf during the whole step, steps being shifted
+// by the groove of opts and velocities changed by its accents.
+func noteTrack(name string, channel int, generations [][]int, opts Options, cells []int,
+	noteOf func(cell, state int) (int, int, error)) ([]event, error) {
+	track := []event{trackName(name)}
+	var playing []int
+	for step, grid := range generations {
+		tick := stepTick(step, opts.Groove)
+		for _, note := range playing {
+			track = append(track, event{tick, []byte{0x80 | byte(channel), byte(note), 0}})
+		}
+		playing = playing[:0]
+		for _, cell := range cells {
+			if grid[cell] == 0 {
+				continue
+			}
+			note, velocity, err := noteOf(cell, grid[cell])
+			if err != nil {
+				return nil, err
+			}
+			if isPlaying(playing, note) {
+				continue
+			}
+			if step < len(opts.Accents) && cell < len(opts.Accents[step]) {
+				velocity = int(math.Max(1, math.Round(float64(velocity)*opts.Accents[step][cell])))
+			}
+			track = append(track, event{tick, []byte{0x90 | byte(channel), byte(note), byte(velocity)}})
+			playing = append(playing, note)
+		}
+	}
+	for _, note := range playing {
+		track = append(track, event{len(generations) * Division, []byte{0x80 | byte(channel), byte(note), 0}})
+	}
+	return track, nil
+}
+
+// stepTick returns the tick of the start of a step.
+func stepTick(step int, g groove.Groove) int {
+	return int(math.Max(0, math.Round((float64(step)+g.Offset(step))*Division)))
+}
+
+func isPlaying(playing []int, note int) bool {
+	for _, n := range playing {
+		if n == note {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTrack(w io.Writer, events []event, endTick int) error {
+	var data []byte
+	tick := 0
+	for _, e := range events {
+		data = appendVarLen(data, e.tick-tick)
+		data = append(data, e.data...)
+		tick = e.tick
+	}
+	if endTick < tick {
+		endTick = tick
+	}
+	data = appendVarLen(data, endTick-tick)
+	data = append(data, 0xFF, 0x2F, 0x00)
+
+	var chunk bytes.Buffer
+	chunk.WriteString("MTrk")
+	binary.Write(&chunk, binary.BigEndian, uint32(len(data)))
+	chunk.Write(data)
+	_, err := w.Write(chunk.Bytes())
+	return err
+}
+
+// appendVarLen appends n as a MIDI variable-length quantity.
+func appendVarLen(data []byte, n int) []byte {
+	var buf [4]byte
+	i := len(buf) - 1
+	buf[i] = byte(n & 0x7F)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		buf[i] = byte(n&0x7F) | 0x80
+	}
+	return append(data, buf[i:]...)
+}
@@ -0,0 +1,129 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/loig/grac/groove"
+)
+
+func TestAppendVarLen(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3FFF, []byte{0xFF, 0x7F}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{0x0FFFFFFF, []byte{0xFF, 0xFF, 0xFF, 0x7F}},
+	}
+	for _, test := range tests {
+		if got := appendVarLen([]byte{0xAA}, test.n); !bytes.Equal(got, append([]byte{0xAA}, test.want...)) {
+			t.Errorf("%#x: got % x, want % x", test.n, got[1:], test.want)
+		}
+	}
+}
+
+// chunks splits a Standard MIDI File into its chunks, checking their
+// lengths.
+func chunks(t *testing.T, data []byte) (types []string, contents [][]byte) {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("truncated chunk header % x", data)
+		}
+		length := int(binary.BigEndian.Uint32(data[4:8]))
+		if len(data) < 8+length {
+			t.Fatalf("chunk %q of length %d with %d bytes", data[:4], length, len(data)-8)
+		}
+		types = append(types, string(data[:4]))
+		contents = append(contents, data[8:8+length])
+		data = data[8+length:]
+	}
+	return types, contents
+}
+
+func TestWriteSMF(t *testing.T) {
+	generations := [][]int{{1, 0}, {0, 2}, {1, 1}}
+	var buf bytes.Buffer
+	if err := WriteSMF(&buf, generations, Options{Tempo: 120}); err != nil {
+		t.Fatal(err)
+	}
+	types, contents := chunks(t, buf.Bytes())
+	if len(types) != 4 || types[0] != "MThd" {
+		t.Fatalf("chunks %q, want a header and 3 tracks", types)
+	}
+	if want := []byte{0, 1, 0, 3, 480 >> 8, 480 & 0xFF}; !bytes.Equal(contents[0], want) {
+		t.Errorf("header % x, want % x", contents[0], want)
+	}
+	for i, track := range contents[1:] {
+		if types[i+1] != "MTrk" {
+			t.Errorf("chunk %d is %q, want MTrk", i+1, types[i+1])
+		}
+		if !bytes.HasSuffix(track, []byte{0xFF, 0x2F, 0x00}) {
+			t.Errorf("track %d does not end with an end of track event", i)
+		}
+	}
+	// 500000 microseconds per quarter note at 120 steps per minute
+	if !bytes.Contains(contents[1], []byte{0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20}) {
+		t.Errorf("no tempo event in % x", contents[1])
+	}
+	// the first cell plays C4 at steps 0 and 2
+	want := []byte{0x00, 0x90, 60, 64, 0x83, 0x60, 0x80, 60, 0, 0x83, 0x60, 0x90, 60, 64}
+	if !bytes.Contains(contents[2], want) {
+		t.Errorf("track of cell 1 % x does not contain % x", contents[2], want)
+	}
+}
+
+func TestWriteSMFTempo(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSMF(&buf, [][]int{{1}}, Options{Tempo: MinTempo}); err != nil {
+		t.Errorf("tempo MinTempo: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte{0xFF, 0x51, 0x03, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("no tempo event of 0xFFFFFF microseconds for MinTempo")
+	}
+	for _, tempo := range []float64{0, -1, MinTempo - 0.01, 1} {
+		if err := WriteSMF(&buf, [][]int{{1}}, Options{Tempo: tempo}); err == nil {
+			t.Errorf("tempo %v accepted", tempo)
+		}
+	}
+}
+
+func TestStepTick(t *testing.T) {
+	tests := []struct {
+		g    groove.Groove
+		want []int
+	}{
+		{groove.Groove{}, []int{0, 480, 960, 1440}},
+		{groove.Groove{Swing: 75}, []int{0, 720, 960, 1680}},
+		{groove.Groove{Offsets: []float64{0, 0.1}}, []int{0, 528, 960, 1488}},
+		{groove.Groove{Offsets: []float64{-0.25, 0}}, []int{0, 480, 840, 1440}},
+	}
+	for _, test := range tests {
+		for step, want := range test.want {
+			if got := stepTick(step, test.g); got != want {
+				t.Errorf("%+v, step %d: tick %d, want %d", test.g, step, got, want)
+			}
+		}
+	}
+}
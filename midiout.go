@@ -0,0 +1,102 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/sound"
+)
+
+// portName returns name, or the first MIDI port found for "auto".
+func portName(name string) (string, error) {
+	if name != "auto" {
+		return name, nil
+	}
+	ports := midi.Ports()
+	if len(ports) == 0 {
+		return "", errors.New("aucun port MIDI trouvé (le module snd-virmidi crée des ports virtuels)")
+	}
+	return ports[0], nil
+}
+
+// openMIDI opens the MIDI port name, or the first one found for "auto",
+// which plays the states with stateNotes.
+func (gD *GameDisplay) openMIDI(name string, stateNotes []midi.StateNote) error {
+	name, err := portName(name)
+	if err != nil {
+		return err
+	}
+	port, err := midi.OpenPort(name)
+	if err != nil {
+		return err
+	}
+	gD.audio.midiOut = port
+	gD.audio.stateNotes = stateNotes
+	return nil
+}
+
+// sendMIDI plays grid on the MIDI port, if any, at time at.
+func (gD *GameDisplay) sendMIDI(grid []int, velocities []float64, at time.Time) {
+	if gD.audio.midiOut == nil {
+		return
+	}
+	var transpose func(cell, state int) int
+	if gD.audio.pitch.Mode != sound.NoPitch {
+		numCells := len(grid)
+		transpose = func(cell, state int) int {
+			return gD.audio.pitch.Semitones(cell, numCells, state)
+		}
+	}
+	if err := gD.audio.midiOut.PlayAt(midi.StepNotes(grid, gD.audio.stateNotes, velocities, transpose), at); err != nil {
+		gD.closeMIDI(err)
+	}
+}
+
+// stopMIDI stops the notes playing on the MIDI port, if any.
+func (gD *GameDisplay) stopMIDI() {
+	if gD.audio.midiOut == nil {
+		return
+	}
+	if err := gD.audio.midiOut.Stop(); err != nil {
+		gD.closeMIDI(err)
+	}
+}
+
+// closeMIDI stops using the MIDI port after err.
+func (gD *GameDisplay) closeMIDI(err error) {
+	gD.releaseMIDI()
+	gD.showMessage(fmt.Sprint("Erreur MIDI : ", err))
+}
+
+// releaseMIDI stops the MIDI clock sent, if any, and closes the MIDI
+// port, if any.
+func (gD *GameDisplay) releaseMIDI() {
+	if gD.audio.midiOut == nil {
+		return
+	}
+	if gD.audio.leader != nil {
+		gD.audio.leader.Stop()
+		gD.audio.leader = nil
+	}
+	gD.audio.midiOut.Close()
+	gD.audio.midiOut = nil
+}
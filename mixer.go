@@ -0,0 +1,139 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// currentChannel is the mixer channel selected, the one of state
+// currentChannel+1.
+var currentChannel int
+
+func (gD *GameDisplay) mixerUpdate() bool {
+	numStates := gD.automaton.NumVal() - 1
+	if currentChannel >= numStates {
+		currentChannel = numStates - 1
+	}
+	c := &gD.audio.mixer.Channels[currentChannel]
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		if currentChannel > 0 {
+			currentChannel--
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		if currentChannel < numStates-1 {
+			currentChannel++
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		c.Volume = math.Min(tenth(c.Volume+0.1), 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		c.Volume = math.Max(tenth(c.Volume-0.1), 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyD):
+		c.Pan = math.Min(tenth(c.Pan+0.1), 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyG):
+		c.Pan = math.Max(tenth(c.Pan-0.1), -1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyM):
+		c.Mute = !c.Mute
+	case inpututil.IsKeyJustPressed(ebiten.KeyI):
+		c.Solo = !c.Solo
+	case inpututil.IsKeyJustPressed(ebiten.KeyV):
+		gD.cycleAccent()
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageUp):
+		if gD.audio.mixer.MaxVoices < globalMaxSize {
+			gD.audio.mixer.MaxVoices++
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageDown):
+		// 0 does not limit the voices
+		if gD.audio.mixer.MaxVoices > 0 {
+			gD.audio.mixer.MaxVoices--
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyF):
+		gD.toggleWindow()
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		gD.toggleRouting()
+	case inpututil.IsKeyJustPressed(ebiten.KeyJ):
+		gD.moveWindow(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyK):
+		gD.moveWindow(1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyU):
+		gD.resizeWindow(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyO):
+		gD.resizeWindow(1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyX):
+		return true
+	}
+	return false
+}
+
+// tenth rounds x to a tenth.
+func tenth(x float64) float64 {
+	return math.Round(10*x) / 10
+}
+
+func (gD *GameDisplay) drawMixer(screen *ebiten.Image) {
+	ebitenutil.DebugPrintAt(screen, "Table de mixage", 10, 490)
+	for i := 0; i < gD.automaton.NumVal()-1; i++ {
+		c := gD.audio.mixer.Channels[i]
+		line := fmt.Sprint("État ", i+1, " : volume ", math.Round(100*c.Volume), " %, ", panName(c.Pan))
+		if c.Mute {
+			line += ", coupé"
+		}
+		if c.Solo {
+			line += ", isolé"
+		}
+		if i == currentChannel {
+			line = "-> " + line
+		} else {
+			line = "   " + line
+		}
+		ebitenutil.DebugPrintAt(screen, line, 10, 505+15*i)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprint("Écoute : ", gD.windowName()), 10, 565)
+	ebitenutil.DebugPrintAt(screen, "   Entrée : revenir à la simulation", 10, 580)
+	ebitenutil.DebugPrintAt(screen, "   Haut, bas, gauche, droite : état, volume", 330, 475)
+	ebitenutil.DebugPrintAt(screen, "   G, D : placer à gauche, à droite", 330, 490)
+	ebitenutil.DebugPrintAt(screen, "   M : couper, I : isoler", 330, 505)
+	ebitenutil.DebugPrintAt(screen, "   V : nuances ("+accentNames[gD.audio.accent]+")", 330, 520)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprint("   Page haut, page bas : ", voicesName(gD.audio.mixer.MaxVoices)), 330, 535)
+	ebitenutil.DebugPrintAt(screen, "   F : écouter quelques cellules ou toutes", 330, 550)
+	ebitenutil.DebugPrintAt(screen, "   J, K, U, O : déplacer, réduire, agrandir", 330, 565)
+	ebitenutil.DebugPrintAt(screen, "   R : une voix par cellule écoutée", 330, 580)
+}
+
+func voicesName(maxVoices int) string {
+	if maxVoices <= 0 {
+		return "sons par état non limités"
+	}
+	return fmt.Sprint(maxVoices, " sons par état au plus")
+}
+
+func panName(pan float64) string {
+	switch {
+	case pan < 0:
+		return fmt.Sprint("à gauche ", math.Round(-100*pan), " %")
+	case pan > 0:
+		return fmt.Sprint("à droite ", math.Round(100*pan), " %")
+	}
+	return "au centre"
+}
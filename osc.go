@@ -0,0 +1,215 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/loig/grac/osc"
+)
+
+// listenOSC starts an OSC server on the UDP address addr, which sends
+// the generations to targets and to the clients that subscribe.
+func (gD *GameDisplay) listenOSC(addr string, targets []string) error {
+	server, err := osc.Listen(addr)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		udpAddr, err := net.ResolveUDPAddr("udp", target)
+		if err != nil {
+			server.Close()
+			return err
+		}
+		if err := server.AddTarget(udpAddr); err != nil {
+			server.Close()
+			return err
+		}
+	}
+	gD.osc = server
+	go server.Serve(gD.oscMessage)
+	return nil
+}
+
+// oscMessage applies a message received by the OSC server.
+func (gD *GameDisplay) oscMessage(m osc.Message, from *net.UDPAddr) {
+	gD.mutex.Lock()
+	defer gD.mutex.Unlock()
+	if err := gD.applyOSC(m, from); err != nil {
+		gD.showMessage(fmt.Sprint("OSC ", m.Address, " : ", err))
+	}
+}
+
+func (gD *GameDisplay) applyOSC(m osc.Message, from *net.UDPAddr) error {
+	if gD.state < stateChooseTempo && m.Address != "/grac/subscribe" && m.Address != "/grac/unsubscribe" {
+		return errors.New("grac démarre")
+	}
+	cA := gD.automaton
+	switch m.Address {
+	case "/grac/subscribe":
+		target, ok := oscTarget(m, from)
+		if !ok {
+			return errOSCArgs
+		}
+		if err := gD.osc.AddTarget(target); err != nil {
+			return errors.New("trop d'abonnés")
+		}
+		return nil
+	case "/grac/unsubscribe":
+		target, ok := oscTarget(m, from)
+		if !ok {
+			return errOSCArgs
+		}
+		gD.osc.RemoveTarget(target)
+		return nil
+	case "/grac/tempo":
+		tempo, ok := m.Float(0)
+		if !ok || math.IsNaN(tempo) || math.IsInf(tempo, 0) {
+			return errOSCArgs
+		}
+		gD.setTempo(tempo)
+		return nil
+	case "/grac/start":
+		if gD.state >= stateRunAutomaton {
+			gD.loop = nil
+		}
+		gD.state = stateRunAutomaton
+		cA.Init()
+		gD.startSteps()
+		return nil
+	case "/grac/stop":
+		if gD.state >= stateRunAutomaton {
+			gD.loop = nil
+			gD.state = stateChooseRules
+		}
+		return nil
+	case "/grac/size":
+		size, ok := m.Int(0)
+		if !ok || size < globalMinSize || size > globalMaxSize {
+			return errOSCArgs
+		}
+		cA.SetSize(size)
+		gD.fitWindow()
+	case "/grac/states":
+		numVal, ok := m.Int(0)
+		if !ok || numVal < globalMinNumVal || numVal > globalMaxNumVal {
+			return errOSCArgs
+		}
+		cA.SetNumVal(numVal)
+	case "/grac/rule":
+		code, ok := ruleCode(m)
+		if !ok {
+			return errOSCArgs
+		}
+		if err := cA.SetRuleCode(code); err != nil {
+			return err
+		}
+	case "/grac/rules":
+		rules, ok := m.Ints()
+		if !ok || len(rules) != len(cA.Rules()) || !validStates(rules, cA.NumVal()) {
+			return errOSCArgs
+		}
+		for i, state := range rules {
+			cA.SetRule(i, state)
+		}
+	case "/grac/init":
+		grid, ok := m.Ints()
+		if !ok || len(grid) != cA.Size() || !validStates(grid, cA.NumVal()) {
+			return errOSCArgs
+		}
+		for i, state := range grid {
+			cA.SetInitialCell(i, state)
+		}
+	case "/grac/cell":
+		args, ok := m.Ints()
+		if !ok || len(args) != 2 || args[0] < 0 || args[0] >= cA.Size() || !validStates(args[1:], cA.NumVal()) {
+			return errOSCArgs
+		}
+		cA.SetInitialCell(args[0], args[1])
+	default:
+		return errors.New("adresse inconnue")
+	}
+	// the automaton changed, it starts again from its initial grid
+	gD.fresh = false
+	gD.loop = nil
+	cA.Init()
+	return nil
+}
+
+var errOSCArgs = errors.New("arguments invalides")
+
+// oscTarget returns the address where the sender of a subscription
+// receives the generations: its own address, or the port given in m.
+func oscTarget(m osc.Message, from *net.UDPAddr) (*net.UDPAddr, bool) {
+	target := *from
+	if port, ok := m.Int(0); ok {
+		if port < 1 || port > 65535 {
+			return nil, false
+		}
+		target.Port = port
+	}
+	return &target, true
+}
+
+// ruleCode reads a rule number given as an integer or, for the large
+// ones, as a string.
+func ruleCode(m osc.Message) (*big.Int, bool) {
+	if n, ok := m.Int(0); ok {
+		return big.NewInt(int64(n)), true
+	}
+	if len(m.Args) == 0 {
+		return nil, false
+	}
+	s, ok := m.Args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func validStates(states []int, numVal int) bool {
+	for _, state := range states {
+		if state < 0 || state >= numVal {
+			return false
+		}
+	}
+	return true
+}
+
+// sendGeneration sends the current generation to the OSC targets, as
+// its number followed by the states of the cells, at time at when it is
+// heard.
+func (gD *GameDisplay) sendGeneration(at time.Time) {
+	if gD.osc == nil {
+		return
+	}
+	args := []interface{}{int32(gD.automaton.Generation())}
+	for _, state := range gD.automaton.Grid() {
+		args = append(args, int32(state))
+	}
+	m := osc.NewMessage("/grac/generation", args...)
+	server := gD.osc
+	time.AfterFunc(time.Until(at), func() {
+		server.Broadcast(m)
+	})
+}
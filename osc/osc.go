@@ -0,0 +1,248 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+// Package osc reads and writes Open Sound Control 1.0 messages and
+// exchanges them over UDP.
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Message is an OSC message. Its arguments are int32, float32, string
+// or []byte (blob) values.
+type Message struct {
+	Address string
+	Args    []interface{}
+}
+
+// NewMessage returns a message with the given address and arguments.
+func NewMessage(address string, args ...interface{}) Message {
+	return Message{Address: address, Args: args}
+}
+
+// MarshalBinary encodes the message.
+func (m Message) MarshalBinary() ([]byte, error) {
+	var data bytes.Buffer
+	writeString(&data, m.Address)
+	tags := []byte{','}
+	var args bytes.Buffer
+	for _, arg := range m.Args {
+		switch v := arg.(type) {
+		case int32:
+			tags = append(tags, 'i')
+			binary.Write(&args, binary.BigEndian, v)
+		case float32:
+			tags = append(tags, 'f')
+			binary.Write(&args, binary.BigEndian, math.Float32bits(v))
+		case string:
+			tags = append(tags, 's')
+			writeString(&args, v)
+		case []byte:
+			tags = append(tags, 'b')
+			binary.Write(&args, binary.BigEndian, uint32(len(v)))
+			args.Write(v)
+			args.Write(make([]byte, (4-len(v)%4)%4))
+		default:
+			return nil, fmt.Errorf("osc: unsupported argument %v", arg)
+		}
+	}
+	writeString(&data, string(tags))
+	data.Write(args.Bytes())
+	return data.Bytes(), nil
+}
+
+// Bundle is an OSC bundle of messages.
+type Bundle []Message
+
+// MarshalBinary encodes the bundle, with the time tag meaning
+// immediately.
+func (b Bundle) MarshalBinary() ([]byte, error) {
+	var data bytes.Buffer
+	data.WriteString("#bundle\x00")
+	binary.Write(&data, binary.BigEndian, uint64(1))
+	for _, m := range b {
+		element, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&data, binary.BigEndian, uint32(len(element)))
+		data.Write(element)
+	}
+	return data.Bytes(), nil
+}
+
+// writeString writes s followed by one to four null bytes, to a
+// multiple of four bytes.
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteString(s)
+	b.Write(make([]byte, 4-len(s)%4))
+}
+
+// Parse decodes a packet, a message or a bundle of messages, possibly
+// nested. The time tags of the bundles are ignored.
+func Parse(data []byte) ([]Message, error) {
+	if bytes.HasPrefix(data, []byte("#bundle\x00")) {
+		if len(data) < 16 {
+			return nil, errors.New("osc: truncated bundle")
+		}
+		var res []Message
+		for rest := data[16:]; len(rest) > 0; {
+			if len(rest) < 4 {
+				return nil, errors.New("osc: truncated bundle")
+			}
+			size := binary.BigEndian.Uint32(rest)
+			if int64(size) > int64(len(rest)-4) {
+				return nil, errors.New("osc: truncated bundle")
+			}
+			messages, err := Parse(rest[4 : 4+size])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, messages...)
+			rest = rest[4+size:]
+		}
+		return res, nil
+	}
+	m, err := parseMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{m}, nil
+}
+
+func parseMessage(data []byte) (Message, error) {
+	var m Message
+	address, rest, err := readString(data)
+	if err != nil {
+		return m, err
+	}
+	if len(address) == 0 || address[0] != '/' {
+		return m, fmt.Errorf("osc: invalid address %q", address)
+	}
+	m.Address = address
+	if len(rest) == 0 {
+		// very old implementations omit the type tags
+		return m, nil
+	}
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return m, err
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return m, fmt.Errorf("osc: invalid type tags %q", tags)
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return m, errors.New("osc: truncated message")
+			}
+			bits := binary.BigEndian.Uint32(rest)
+			if tag == 'i' {
+				m.Args = append(m.Args, int32(bits))
+			} else {
+				m.Args = append(m.Args, math.Float32frombits(bits))
+			}
+			rest = rest[4:]
+		case 's':
+			var s string
+			s, rest, err = readString(rest)
+			if err != nil {
+				return m, err
+			}
+			m.Args = append(m.Args, s)
+		case 'b':
+			if len(rest) < 4 {
+				return m, errors.New("osc: truncated message")
+			}
+			size := binary.BigEndian.Uint32(rest)
+			if int64(size) > int64(len(rest)-4) {
+				return m, errors.New("osc: truncated blob")
+			}
+			// data may be reused by the caller
+			m.Args = append(m.Args, append([]byte{}, rest[4:4+size]...))
+			next := 4 + (int(size)+3)/4*4
+			if next > len(rest) {
+				next = len(rest)
+			}
+			rest = rest[next:]
+		default:
+			return m, fmt.Errorf("osc: unsupported type tag %q", tag)
+		}
+	}
+	return m, nil
+}
+
+// readString reads a null-terminated string padded to a multiple of
+// four bytes, and returns it with the rest of data.
+func readString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, errors.New("osc: unterminated string")
+	}
+	next := (end/4 + 1) * 4
+	if next > len(data) {
+		next = len(data)
+	}
+	return string(data[:end]), data[next:], nil
+}
+
+// Int returns argument i as an integer, if it is a number.
+func (m Message) Int(i int) (int, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch v := m.Args[i].(type) {
+	case int32:
+		return int(v), true
+	case float32:
+		return int(math.Round(float64(v))), true
+	}
+	return 0, false
+}
+
+// Float returns argument i as a float, if it is a number.
+func (m Message) Float(i int) (float64, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch v := m.Args[i].(type) {
+	case int32:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Ints returns the arguments as integers, if they all are numbers.
+func (m Message) Ints() ([]int, bool) {
+	res := make([]int, len(m.Args))
+	for i := range m.Args {
+		n, ok := m.Int(i)
+		if !ok {
+			return nil, false
+		}
+		res[i] = n
+	}
+	return res, true
+}
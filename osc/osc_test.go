@@ -0,0 +1,224 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// element returns data preceded by its size, as in a bundle.
+func element(data []byte) []byte {
+	res := make([]byte, 4)
+	binary.BigEndian.PutUint32(res, uint32(len(data)))
+	return append(res, data...)
+}
+
+// bundleHeader is the start of a bundle with the time tag immediately.
+const bundleHeader = "#bundle\x00\x00\x00\x00\x00\x00\x00\x00\x01"
+
+func TestMarshalMessage(t *testing.T) {
+	tests := []struct {
+		m    Message
+		want string
+	}{
+		{NewMessage("/a"), "/a\x00\x00,\x00\x00\x00"},
+		{NewMessage("/abc"), "/abc\x00\x00\x00\x00,\x00\x00\x00"},
+		{NewMessage("/a", int32(1)), "/a\x00\x00,i\x00\x00\x00\x00\x00\x01"},
+		{NewMessage("/a", int32(-2)), "/a\x00\x00,i\x00\x00\xFF\xFF\xFF\xFE"},
+		{NewMessage("/a", float32(-1.5)), "/a\x00\x00,f\x00\x00\xBF\xC0\x00\x00"},
+		{NewMessage("/a", "abc"), "/a\x00\x00,s\x00\x00abc\x00"},
+		{NewMessage("/a", "hello"), "/a\x00\x00,s\x00\x00hello\x00\x00\x00"},
+		{NewMessage("/a", []byte{1, 2, 3}), "/a\x00\x00,b\x00\x00\x00\x00\x00\x03\x01\x02\x03\x00"},
+		{NewMessage("/a", []byte{1, 2, 3, 4}), "/a\x00\x00,b\x00\x00\x00\x00\x00\x04\x01\x02\x03\x04"},
+		{NewMessage("/a", []byte{}), "/a\x00\x00,b\x00\x00\x00\x00\x00\x00"},
+		{NewMessage("/a", int32(1), "x"), "/a\x00\x00,is\x00\x00\x00\x00\x01x\x00\x00\x00"},
+	}
+	for _, test := range tests {
+		got, err := test.m.MarshalBinary()
+		if err != nil {
+			t.Errorf("%v: %v", test.m, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%v: got %q, want %q", test.m, got, test.want)
+		}
+	}
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	for _, arg := range []interface{}{1, 1.5, true, nil} {
+		if _, err := NewMessage("/a", arg).MarshalBinary(); err == nil {
+			t.Errorf("%T argument: no error", arg)
+		}
+		if _, err := (Bundle{NewMessage("/a", arg)}).MarshalBinary(); err == nil {
+			t.Errorf("%T argument in a bundle: no error", arg)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Address: "/a"},
+		{Address: "/grac/generation", Args: []interface{}{int32(3), int32(0), int32(1), int32(2)}},
+		{Address: "/grac/tempo", Args: []interface{}{float32(92.5)}},
+		{Address: "/grac/rule", Args: []interface{}{"123456789012345678901234567890"}},
+		{Address: "/x", Args: []interface{}{"", "a", "ab", "abc", "abcd"}},
+		{Address: "/x", Args: []interface{}{[]byte{}, []byte{1}, []byte{1, 2, 3, 4, 5}, int32(7)}},
+		{Address: "/mixed", Args: []interface{}{int32(-1), float32(0.25), "s", []byte{0, 0xFF}}},
+	}
+	for _, m := range messages {
+		data, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data)%4 != 0 {
+			t.Errorf("%v: %d bytes", m, len(data))
+		}
+		got, err := Parse(data)
+		if err != nil {
+			t.Errorf("%v: %v", m, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, []Message{m}) {
+			t.Errorf("got %v, want %v", got, m)
+		}
+	}
+
+	data, err := Bundle(messages).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(bundleHeader)) {
+		t.Errorf("bundle starts with %q", data[:16])
+	}
+	got, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, messages) {
+		t.Errorf("bundle: got %v, want %v", got, messages)
+	}
+
+	// nested bundles are flattened
+	inner, _ := Bundle(messages[1:3]).MarshalBinary()
+	first, _ := messages[0].MarshalBinary()
+	nested := append([]byte(bundleHeader), element(first)...)
+	nested = append(nested, element(inner)...)
+	got, err = Parse(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, messages[:3]) {
+		t.Errorf("nested bundle: got %v, want %v", got, messages[:3])
+	}
+
+	got, err = Parse([]byte(bundleHeader))
+	if err != nil || len(got) != 0 {
+		t.Errorf("empty bundle: got %v, %v", got, err)
+	}
+}
+
+func TestParseWithoutTypeTags(t *testing.T) {
+	got, err := Parse([]byte("/a\x00\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Message{{Address: "/a"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseBlobCopy(t *testing.T) {
+	data, _ := NewMessage("/a", []byte{1, 2}).MarshalBinary()
+	got, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		data[i] = 0
+	}
+	if blob := got[0].Args[0].([]byte); !bytes.Equal(blob, []byte{1, 2}) {
+		t.Errorf("blob changed to %v with the packet", blob)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	message, _ := NewMessage("/a", int32(1)).MarshalBinary()
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"unterminated address", "/abc"},
+		{"no slash", "abc\x00"},
+		{"empty address", "\x00\x00\x00\x00"},
+		{"no comma", "/a\x00\x00i\x00\x00\x00\x00\x00\x00\x01"},
+		{"unterminated tags", "/a\x00\x00,i"},
+		{"unknown tag", "/a\x00\x00,x\x00\x00\x00\x00\x00\x01"},
+		{"truncated int", "/a\x00\x00,i\x00\x00\x00\x01"},
+		{"missing float", "/a\x00\x00,if\x00\x00\x00\x00\x00\x01"},
+		{"unterminated string", "/a\x00\x00,s\x00\x00abcd"},
+		{"truncated blob size", "/a\x00\x00,b\x00\x00\x00\x00"},
+		{"truncated blob", "/a\x00\x00,b\x00\x00\x00\x00\x00\x08\x01\x02\x03\x04"},
+		{"huge blob", "/a\x00\x00,b\x00\x00\xFF\xFF\xFF\xFF\x01\x02\x03\x04"},
+		{"truncated bundle", "#bundle\x00\x00\x00\x00\x00"},
+		{"truncated element size", bundleHeader + "\x00\x00"},
+		{"truncated element", bundleHeader + string(element(message)[:len(message)])},
+		{"huge element", bundleHeader + "\xFF\xFF\xFF\xFF" + string(message)},
+		{"empty element", bundleHeader + "\x00\x00\x00\x00"},
+		{"invalid element", bundleHeader + string(element([]byte("abc\x00")))},
+	}
+	for _, test := range tests {
+		if got, err := Parse([]byte(test.data)); err == nil {
+			t.Errorf("%s: got %v, no error", test.name, got)
+		}
+	}
+}
+
+func TestMessageArgs(t *testing.T) {
+	m := NewMessage("/a", int32(3), float32(2.6), "4", []byte{5})
+	if n, ok := m.Int(0); !ok || n != 3 {
+		t.Errorf("Int(0) = %v, %v", n, ok)
+	}
+	if n, ok := m.Int(1); !ok || n != 3 {
+		t.Errorf("Int(1) = %v, %v", n, ok)
+	}
+	if f, ok := m.Float(1); !ok || f != float64(float32(2.6)) {
+		t.Errorf("Float(1) = %v, %v", f, ok)
+	}
+	if f, ok := m.Float(0); !ok || f != 3 {
+		t.Errorf("Float(0) = %v, %v", f, ok)
+	}
+	for i := 2; i <= 4; i++ {
+		if _, ok := m.Int(i); ok {
+			t.Errorf("Int(%d) accepted", i)
+		}
+		if _, ok := m.Float(i); ok {
+			t.Errorf("Float(%d) accepted", i)
+		}
+	}
+	if _, ok := m.Ints(); ok {
+		t.Error("Ints accepted a string")
+	}
+	if ints, ok := NewMessage("/a", int32(1), float32(2)).Ints(); !ok || !reflect.DeepEqual(ints, []int{1, 2}) {
+		t.Errorf("Ints() = %v, %v", ints, ok)
+	}
+}
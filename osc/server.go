@@ -0,0 +1,147 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package osc
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// maxPacket is the size of the largest packet read.
+const maxPacket = 65507
+
+// MaxTargets is the largest number of targets of a server.
+const MaxTargets = 32
+
+// Server receives OSC messages on a UDP port and sends messages to
+// targets from the same port.
+type Server struct {
+	conn    *net.UDPConn
+	mu      sync.Mutex
+	targets []*net.UDPAddr
+}
+
+// Listen returns a server listening on the UDP address addr, such as
+// ":9000".
+func Listen(addr string) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn: conn}, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve reads messages until the server is closed, and calls handle for
+// each of them. Invalid packets are ignored.
+func (s *Server) Serve(handle func(m Message, from *net.UDPAddr)) error {
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		messages, err := Parse(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range messages {
+			handle(m, from)
+		}
+	}
+}
+
+// AddTarget makes Broadcast send the messages to addr, if it does not
+// already. It fails when the server already has MaxTargets targets.
+func (s *Server) AddTarget(addr *net.UDPAddr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.target(addr) >= 0 {
+		return nil
+	}
+	if len(s.targets) >= MaxTargets {
+		return errors.New("osc: too many targets")
+	}
+	s.targets = append(s.targets, addr)
+	return nil
+}
+
+// RemoveTarget stops sending the messages of Broadcast to addr.
+func (s *Server) RemoveTarget(addr *net.UDPAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.target(addr); i >= 0 {
+		s.targets = append(s.targets[:i], s.targets[i+1:]...)
+	}
+}
+
+// target returns the index of addr in the targets, or -1.
+func (s *Server) target(addr *net.UDPAddr) int {
+	for i, t := range s.targets {
+		if t.IP.Equal(addr.IP) && t.Port == addr.Port {
+			return i
+		}
+	}
+	return -1
+}
+
+// Broadcast sends m to all the targets, even when sending to some of
+// them fails, and returns the first error.
+func (s *Server) Broadcast(m Message) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.targets {
+		if _, writeErr := s.conn.WriteToUDP(data, t); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Send sends m to the UDP address addr, such as "localhost:9000".
+func Send(addr string, m Message) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(data)
+	return err
+}
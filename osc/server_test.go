@@ -0,0 +1,197 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package osc
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listenClient returns a UDP connection on a free port of the loopback
+// interface.
+func listenClient(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// receive reads a packet sent to conn and parses it.
+func receive(conn *net.UDPConn, timeout time.Duration) ([]Message, error) {
+	buf := make([]byte, maxPacket)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(buf[:n])
+}
+
+// mustMarshal encodes m.
+func mustMarshal(t *testing.T, m Message) []byte {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestServe(t *testing.T) {
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type received struct {
+		m    Message
+		from string
+	}
+	messages := make(chan received, 10)
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(func(m Message, from *net.UDPAddr) {
+			messages <- received{m, from.String()}
+		})
+	}()
+
+	client := listenClient(t)
+	defer client.Close()
+	serverAddr := server.Addr().(*net.UDPAddr)
+	m := NewMessage("/grac/tempo", float32(120))
+	bundle, _ := Bundle{NewMessage("/grac/size", int32(31)), NewMessage("/grac/start")}.MarshalBinary()
+	for _, packet := range []string{"garbage", string(mustMarshal(t, m)), string(bundle)} {
+		if _, err := client.WriteToUDP([]byte(packet), serverAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the invalid packet is ignored
+	want := []Message{m, NewMessage("/grac/size", int32(31)), {Address: "/grac/start"}}
+	for _, w := range want {
+		select {
+		case r := <-messages:
+			if !reflect.DeepEqual(r.m, w) {
+				t.Errorf("got %v, want %v", r.m, w)
+			}
+			if r.from != client.LocalAddr().String() {
+				t.Errorf("message from %s, want %s", r.from, client.LocalAddr())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v not received", w)
+		}
+	}
+
+	if err := Send(serverAddr.String(), m); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-messages:
+		if !reflect.DeepEqual(r.m, m) {
+			t.Errorf("Send: got %v, want %v", r.m, m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message of Send not received")
+	}
+
+	server.Close()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Error("Serve returned no error once closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve still running once closed")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	clients := []*net.UDPConn{listenClient(t), listenClient(t)}
+	for _, client := range clients {
+		defer client.Close()
+		addr := client.LocalAddr().(*net.UDPAddr)
+		if err := server.AddTarget(addr); err != nil {
+			t.Fatal(err)
+		}
+		// adding a target twice sends the messages once
+		if err := server.AddTarget(&net.UDPAddr{IP: addr.IP, Port: addr.Port}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewMessage("/grac/generation", int32(0), int32(1), int32(0))
+	if err := server.Broadcast(m); err != nil {
+		t.Fatal(err)
+	}
+	for i, client := range clients {
+		got, err := receive(client, time.Second)
+		if err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, []Message{m}) {
+			t.Errorf("client %d: got %v, want %v", i, got, m)
+		}
+		if got, err := receive(client, 50*time.Millisecond); err == nil {
+			t.Errorf("client %d: %v received twice", i, got)
+		}
+	}
+
+	server.RemoveTarget(clients[0].LocalAddr().(*net.UDPAddr))
+	if err := server.Broadcast(m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receive(clients[1], time.Second); err != nil {
+		t.Errorf("remaining target: %v", err)
+	}
+	if got, err := receive(clients[0], 50*time.Millisecond); err == nil {
+		t.Errorf("removed target received %v", got)
+	}
+
+	if err := server.Broadcast(NewMessage("/a", 1)); err == nil {
+		t.Error("invalid message broadcast")
+	}
+}
+
+func TestMaxTargets(t *testing.T) {
+	server, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	for port := 1; port <= MaxTargets; port++ {
+		if err := server.AddTarget(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}); err != nil {
+			t.Fatalf("target %d: %v", port, err)
+		}
+	}
+	extra := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: MaxTargets + 1}
+	if err := server.AddTarget(extra); err == nil {
+		t.Error("too many targets accepted")
+	}
+	if err := server.AddTarget(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}); err != nil {
+		t.Errorf("known target refused: %v", err)
+	}
+	server.RemoveTarget(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+	if err := server.AddTarget(extra); err != nil {
+		t.Errorf("target refused after a removal: %v", err)
+	}
+}
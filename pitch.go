@@ -0,0 +1,102 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"github.com/loig/grac/sound"
+)
+
+var pitchNames []string = []string{
+	"aucune",
+	"timbre selon l'état",
+	"octave selon l'état",
+}
+
+var scaleNames []string = []string{
+	"majeure",
+	"pentatonique",
+	"chromatique",
+	"personnalisée",
+}
+
+// scales are the scales that can be chosen, the predefined ones
+// followed by a custom one, if any.
+var scales [][]int = predefinedScales()
+
+func predefinedScales() [][]int {
+	res := make([][]int, len(sound.Scales))
+	for i, scale := range sound.Scales {
+		res[i] = scale.Steps
+	}
+	return res
+}
+
+// addScale makes scale available, if it is not already, and returns its
+// position in scales. Only one custom scale is kept.
+func addScale(scale []int) int {
+	for i, s := range scales {
+		if sameScale(s, scale) {
+			return i
+		}
+	}
+	scales = append(scales[:len(sound.Scales)], scale)
+	return len(scales) - 1
+}
+
+func sameScale(s1, s2 []int) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+	for i := range s1 {
+		if s1[i] != s2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (gD *GameDisplay) cyclePitchMode() {
+	gD.audio.pitch.Mode = (gD.audio.pitch.Mode + 1) % sound.PitchMode(len(pitchNames))
+	gD.audio.cellSounds = nil
+}
+
+func (gD *GameDisplay) cycleScale() {
+	gD.audio.scalePos = (gD.audio.scalePos + 1) % len(scales)
+	gD.audio.pitch.Scale = scales[gD.audio.scalePos]
+	gD.audio.cellSounds = nil
+}
+
+func (gD *GameDisplay) setPitchMap(pitch sound.PitchMap) {
+	if pitch.Scale == nil {
+		pitch.Scale = scales[0]
+	}
+	gD.audio.scalePos = addScale(pitch.Scale)
+	gD.audio.pitch = pitch
+	gD.audio.cellSounds = nil
+}
+
+// cellSounds returns the sounds of the cells of the automaton, with the
+// current sound set and pitch mapping.
+func (gD *GameDisplay) cellSounds() [][][]byte {
+	numCells := gD.automaton.Size()
+	if gD.audio.cellSounds == nil || len(gD.audio.cellSounds) != numCells || gD.audio.cellSoundSet != gD.audio.soundset {
+		gD.audio.cellSounds = gD.audio.pitch.CellSounds(sounds[gD.audio.soundset][:], numCells)
+		gD.audio.cellSoundSet = gD.audio.soundset
+	}
+	return gD.audio.cellSounds
+}
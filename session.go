@@ -0,0 +1,87 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/loig/grac/session"
+)
+
+const defaultSessionFile = "grac-session.json"
+
+func (gD *GameDisplay) saveSession() {
+	s := session.FromAutomaton(gD.automaton)
+	s.Tempo = gD.tempo
+	s.Swing = gD.groove.Swing
+	s.Offsets = gD.groove.Offsets
+	s.Mixer = gD.audio.mixer.Channels
+	s.Accent = gD.audio.accent.String()
+	s.MaxVoices = gD.audio.mixer.MaxVoices
+	s.Listen = gD.audio.window.Cells
+	s.Voices = gD.audio.window.Voices
+	s.SoundSet = gD.audio.soundset
+	s.UseSound = gD.audio.use
+	s.Pitch = gD.audio.pitch.Mode.String()
+	s.Scale = gD.audio.pitch.Scale
+	if err := s.SaveFile(gD.sessionFile); err != nil {
+		gD.showMessage(fmt.Sprint("Erreur : ", err))
+		return
+	}
+	gD.showMessage(fmt.Sprint("Session enregistrée : ", gD.sessionFile))
+}
+
+func (gD *GameDisplay) loadSession() {
+	if err := gD.applySessionFile(); err != nil {
+		gD.showMessage(fmt.Sprint("Erreur : ", err))
+		return
+	}
+	gD.showMessage(fmt.Sprint("Session chargée : ", gD.sessionFile))
+}
+
+// applySessionFile replaces all the parameters by those of the session
+// file and goes to the rules screen.
+func (gD *GameDisplay) applySessionFile() error {
+	s, err := session.LoadFile(gD.sessionFile)
+	if err != nil {
+		return err
+	}
+	cA, err := s.Automaton()
+	if err != nil {
+		return err
+	}
+	if s.SoundSet < 0 || s.SoundSet >= len(sounds) {
+		return fmt.Errorf("session: invalid sound set %d", s.SoundSet)
+	}
+	gD.automaton = cA
+	gD.tempo = clampTempo(s.Tempo)
+	gD.setSessionGroove(s.Groove())
+	gD.audio.mixer = s.SoundMixer()
+	gD.audio.accent = s.SoundAccent()
+	gD.setSessionWindow(s.Window())
+	gD.audio.soundset = s.SoundSet
+	gD.audio.use = s.UseSound
+	gD.setPitchMap(s.PitchMap())
+	gD.fresh = false
+	gD.loop = nil
+	gD.frame = 0
+	currentRule = 0
+	currentCell = 0
+	gD.state = stateChooseRules
+	return nil
+}
@@ -0,0 +1,296 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package session saves and loads all the parameters of a GRAC
+// automaton, so that it can be prepared in advance and reused.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/loig/grac/automaton"
+	"github.com/loig/grac/groove"
+	"github.com/loig/grac/sound"
+)
+
+// Version is the version of the session format written by this package.
+// Sessions with a greater version cannot be loaded.
+const Version = 10
+
+// Session holds the parameters of an automaton and of its playback.
+type Session struct {
+	Version int `json:"version"`
+	// Tempo is the number of steps per minute.
+	Tempo  float64 `json:"tempo"`
+	Size   int     `json:"size"`
+	NumVal int     `json:"numVal"`
+	// Family is the name of the rule family, see automaton.RuleFamily.
+	// It is "table" for sessions of version 1.
+	Family string `json:"family"`
+	// Radius is the radius of the neighborhoods. It is 1 for sessions
+	// of version 1 and 2.
+	Radius      int   `json:"radius"`
+	Rules       []int `json:"rules"`
+	InitialGrid []int `json:"initialGrid"`
+	// Boundary is the name of the boundary conditions, see
+	// automaton.Boundary. It is "periodic" for sessions of version 1 to 3.
+	Boundary      string `json:"boundary"`
+	BoundaryValue int    `json:"boundaryValue"`
+	SoundSet      int    `json:"soundSet"`
+	UseSound      bool   `json:"useSound"`
+	// Pitch is the name of the pitch mode of the cells, see
+	// sound.PitchMode, and Scale the semitones of the scale they play.
+	// Pitch is "none" for sessions of version 1 to 4.
+	Pitch string `json:"pitch"`
+	Scale []int  `json:"scale,omitempty"`
+	// Swing and Offsets give the groove of the steps, see groove.Groove.
+	// They are absent from sessions of version 1 to 5.
+	Swing   float64   `json:"swing,omitempty"`
+	Offsets []float64 `json:"offsets,omitempty"`
+	// Mixer gives the mixer channel of each non-zero state. It is absent
+	// from sessions of version 1 to 6.
+	Mixer []sound.Channel `json:"mixer,omitempty"`
+	// Accent is the name of the way the velocity of the cells is
+	// computed, see sound.Accent. It is "none" for sessions of version 1
+	// to 7.
+	Accent string `json:"accent"`
+	// MaxVoices is the number of sounds each state can play at the same
+	// step, 0 meaning no limit. It is sound.DefaultMaxVoices for
+	// sessions of version 1 to 8.
+	MaxVoices int `json:"maxVoices"`
+	// Listen gives the audible cells, numbered from 0, and Voices the
+	// voice of each of them, see sound.Window. They are absent from
+	// sessions of version 1 to 9, where all the cells are audible.
+	Listen []int `json:"listen,omitempty"`
+	Voices []int `json:"voices,omitempty"`
+}
+
+// FromAutomaton returns a session holding the parameters of cA.
+func FromAutomaton(cA *automaton.CelAut) *Session {
+	s := &Session{
+		Version:       Version,
+		Size:          cA.Size(),
+		NumVal:        cA.NumVal(),
+		Family:        cA.Family().String(),
+		Radius:        cA.Radius(),
+		Rules:         make([]int, len(cA.Rules())),
+		InitialGrid:   make([]int, len(cA.InitialGrid())),
+		Boundary:      cA.Boundary().String(),
+		BoundaryValue: cA.BoundaryValue(),
+		Pitch:         sound.NoPitch.String(),
+		Accent:        sound.NoAccent.String(),
+		MaxVoices:     sound.DefaultMaxVoices,
+	}
+	copy(s.Rules, cA.Rules())
+	copy(s.InitialGrid, cA.InitialGrid())
+	return s
+}
+
+// PitchMap returns the pitch mapping of the cells of the session.
+func (s *Session) PitchMap() sound.PitchMap {
+	pitch, _ := sound.ParsePitchMode(s.Pitch)
+	return sound.PitchMap{Mode: pitch, Scale: s.Scale}
+}
+
+// Groove returns the groove of the steps of the session.
+func (s *Session) Groove() groove.Groove {
+	return groove.Groove{Swing: s.Swing, Offsets: s.Offsets}
+}
+
+// SoundMixer returns the mixer of the session, with a channel for each
+// non-zero state.
+func (s *Session) SoundMixer() sound.Mixer {
+	m := sound.NewMixer(automaton.MaxNumVal - 1)
+	copy(m.Channels, s.Mixer)
+	m.MaxVoices = s.MaxVoices
+	return m
+}
+
+// Window returns the audible cells of the session.
+func (s *Session) Window() sound.Window {
+	return sound.Window{Cells: s.Listen, Voices: s.Voices}
+}
+
+// SoundAccent returns the way the velocity of the cells is computed.
+func (s *Session) SoundAccent() sound.Accent {
+	accent, _ := sound.ParseAccent(s.Accent)
+	return accent
+}
+
+// Automaton returns a new automaton, at generation 0, with the
+// parameters of the session.
+func (s *Session) Automaton() (*automaton.CelAut, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	family, _ := automaton.ParseRuleFamily(s.Family)
+	boundary, _ := automaton.ParseBoundary(s.Boundary)
+	cA := automaton.New()
+	cA.SetSize(s.Size)
+	cA.SetNumVal(s.NumVal)
+	cA.SetRadius(s.Radius)
+	cA.SetFamily(family)
+	for i, state := range s.Rules {
+		cA.SetRule(i, state)
+	}
+	for i, state := range s.InitialGrid {
+		cA.SetInitialCell(i, state)
+	}
+	cA.SetBoundary(boundary)
+	cA.SetBoundaryValue(s.BoundaryValue)
+	cA.Init()
+	return cA, nil
+}
+
+func (s *Session) check() error {
+	if s.Version > Version {
+		return fmt.Errorf("session: version %d is not supported", s.Version)
+	}
+	if s.Tempo <= 0 {
+		return fmt.Errorf("session: invalid tempo %v", s.Tempo)
+	}
+	if s.Size < automaton.MinSize || s.Size > automaton.MaxSize {
+		return fmt.Errorf("session: invalid size %d", s.Size)
+	}
+	if s.NumVal < automaton.MinNumVal || s.NumVal > automaton.MaxNumVal {
+		return fmt.Errorf("session: invalid number of states %d", s.NumVal)
+	}
+	family, err := automaton.ParseRuleFamily(s.Family)
+	if err != nil {
+		return err
+	}
+	if s.Radius < automaton.MinRadius || s.Radius > automaton.MaxRadius || (s.Radius > 1 && s.NumVal > 2) {
+		return fmt.Errorf("session: invalid radius %d", s.Radius)
+	}
+	if numRules := automaton.NumRules(family, s.NumVal, s.Radius); len(s.Rules) != numRules {
+		return fmt.Errorf("session: %d rules instead of %d", len(s.Rules), numRules)
+	}
+	if _, err := automaton.ParseBoundary(s.Boundary); err != nil {
+		return err
+	}
+	if s.BoundaryValue < 0 || s.BoundaryValue >= s.NumVal {
+		return fmt.Errorf("session: invalid boundary value %d", s.BoundaryValue)
+	}
+	if len(s.InitialGrid) != s.Size {
+		return fmt.Errorf("session: %d cells in initial grid instead of %d", len(s.InitialGrid), s.Size)
+	}
+	if err := s.Groove().Check(); err != nil {
+		return err
+	}
+	if len(s.Mixer) > automaton.MaxNumVal-1 {
+		return fmt.Errorf("session: %d mixer channels", len(s.Mixer))
+	}
+	for _, c := range s.Mixer {
+		if c.Volume < 0 || c.Volume > 1 || c.Pan < -1 || c.Pan > 1 {
+			return fmt.Errorf("session: invalid mixer channel %+v", c)
+		}
+	}
+	if err := s.Window().Check(s.Size, automaton.MaxNumVal-1); err != nil {
+		return err
+	}
+	if s.MaxVoices < 0 {
+		return fmt.Errorf("session: invalid number of voices %d", s.MaxVoices)
+	}
+	if _, err := sound.ParseAccent(s.Accent); err != nil {
+		return err
+	}
+	pitch, err := sound.ParsePitchMode(s.Pitch)
+	if err != nil {
+		return err
+	}
+	if pitch != sound.NoPitch {
+		if err := sound.CheckScale(s.Scale); err != nil {
+			return err
+		}
+	}
+	for _, states := range [][]int{s.Rules, s.InitialGrid} {
+		for _, state := range states {
+			if state < 0 || state >= s.NumVal {
+				return fmt.Errorf("session: invalid state %d", state)
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads a session in JSON.
+func Load(r io.Reader) (*Session, error) {
+	var s Session
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version < 2 {
+		s.Family = automaton.Table.String()
+	}
+	if s.Version < 3 {
+		s.Radius = 1
+	}
+	if s.Version < 4 {
+		s.Boundary = automaton.Periodic.String()
+	}
+	if s.Version < 5 {
+		s.Pitch = sound.NoPitch.String()
+	}
+	if s.Version < 8 {
+		s.Accent = sound.NoAccent.String()
+	}
+	if s.Version < 9 {
+		s.MaxVoices = sound.DefaultMaxVoices
+	}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save writes the session in JSON.
+func (s *Session) Save(w io.Writer) error {
+	s.Version = Version
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// LoadFile reads a session from the named file.
+func LoadFile(name string) (*Session, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+// SaveFile writes the session to the named file.
+func (s *Session) SaveFile(name string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := s.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,136 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/loig/grac/sound"
+)
+
+// TestLoadVersions loads a session written by each version of the
+// format and checks the fields that version introduced, or their
+// default value when they are absent.
+func TestLoadVersions(t *testing.T) {
+	tests := []struct {
+		version int
+		check   func(s *Session) error
+	}{
+		{1, func(s *Session) error {
+			return expect(s.Tempo == 80 && s.Family == "table" && s.Radius == 1 && s.Boundary == "periodic" &&
+				s.Pitch == "none" && s.Accent == "none" && s.MaxVoices == sound.DefaultMaxVoices &&
+				s.SoundSet == 1 && s.UseSound && s.Listen == nil && s.Mixer == nil && s.Swing == 0)
+		}},
+		{2, func(s *Session) error {
+			return expect(s.Family == "totalistic" && s.NumVal == 3 && s.Radius == 1 && s.Boundary == "periodic")
+		}},
+		{3, func(s *Session) error {
+			return expect(s.Radius == 2 && len(s.Rules) == 32 && s.Boundary == "periodic")
+		}},
+		{4, func(s *Session) error {
+			return expect(s.Boundary == "fixed" && s.BoundaryValue == 1 && s.Pitch == "none")
+		}},
+		{5, func(s *Session) error {
+			return expect(s.Pitch == "octave" && reflect.DeepEqual(s.Scale, []int{0, 2, 4, 7, 9}) && s.Tempo == 92.5)
+		}},
+		{6, func(s *Session) error {
+			return expect(s.Swing == 67 && reflect.DeepEqual(s.Offsets, []float64{0, 0.1}) && s.Mixer == nil)
+		}},
+		{7, func(s *Session) error {
+			return expect(reflect.DeepEqual(s.Mixer, []sound.Channel{{Volume: 0.5, Pan: -1, Mute: true}}) && s.Accent == "none")
+		}},
+		{8, func(s *Session) error {
+			return expect(s.Accent == "cycle" && s.MaxVoices == sound.DefaultMaxVoices)
+		}},
+		{9, func(s *Session) error {
+			return expect(s.MaxVoices == 0 && s.Listen == nil)
+		}},
+		{10, func(s *Session) error {
+			return expect(s.Accent == "changes" && s.MaxVoices == 3 &&
+				reflect.DeepEqual(s.Listen, []int{1, 2, 3}) && reflect.DeepEqual(s.Voices, []int{1, 2, 1}))
+		}},
+	}
+	if len(tests) != Version {
+		t.Errorf("%d versions tested instead of %d", len(tests), Version)
+	}
+	for _, test := range tests {
+		s, err := LoadFile(filepath.Join("testdata", fmt.Sprint("version", test.version, ".json")))
+		if err != nil {
+			t.Errorf("version %d: %v", test.version, err)
+			continue
+		}
+		if err := test.check(s); err != nil {
+			t.Errorf("version %d: %v in %+v", test.version, err, s)
+		}
+		if _, err := s.Automaton(); err != nil {
+			t.Errorf("version %d: %v", test.version, err)
+		}
+	}
+}
+
+func expect(ok bool) error {
+	if !ok {
+		return fmt.Errorf("unexpected field")
+	}
+	return nil
+}
+
+func TestLoadFutureVersion(t *testing.T) {
+	_, err := LoadFile(filepath.Join("testdata", "future.json"))
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("got error %v for a future version", err)
+	}
+}
+
+// Tempos were integers before they could be tapped, without a change
+// of version: both must load.
+func TestLoadTempo(t *testing.T) {
+	for _, tempo := range []string{"80", "80.0", "92.5"} {
+		json := fmt.Sprintf(`{"version": 1, "tempo": %s, "size": 3, "numVal": 2, "rules": [0, 0, 0, 0, 0, 0, 0, 0], "initialGrid": [0, 1, 0]}`, tempo)
+		s, err := Load(strings.NewReader(json))
+		if err != nil {
+			t.Errorf("tempo %s: %v", tempo, err)
+			continue
+		}
+		if got := fmt.Sprint(s.Tempo); got != strings.TrimSuffix(tempo, ".0") {
+			t.Errorf("tempo %s loaded as %v", tempo, s.Tempo)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	s, err := LoadFile(filepath.Join("testdata", "version10.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, loaded) {
+		t.Errorf("saved %+v, loaded %+v", s, loaded)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"fmt"
+)
+
+// Accent tells how the velocity of the cells, between 0 and 1, comes
+// from the automaton.
+type Accent int
+
+const (
+	// NoAccent plays all the cells at full velocity.
+	NoAccent Accent = iota
+	// AccentChanges plays the cells that just changed state louder than
+	// the other ones.
+	AccentChanges
+	// AccentNeighbors plays the cells louder when their neighbors, as
+	// given by the automaton, are active.
+	AccentNeighbors
+	// AccentCycle plays the first step of the cycle of the automaton at
+	// full velocity, and the following ones softer and softer.
+	AccentCycle
+)
+
+var accentNames = []string{"none", "changes", "neighbors", "cycle"}
+
+func (a Accent) String() string {
+	if a < 0 || int(a) >= len(accentNames) {
+		return fmt.Sprint("Accent(", int(a), ")")
+	}
+	return accentNames[a]
+}
+
+// ParseAccent returns the accent with the given name.
+func ParseAccent(name string) (Accent, error) {
+	for i, n := range accentNames {
+		if n == name {
+			return Accent(i), nil
+		}
+	}
+	return 0, fmt.Errorf("sound: unknown accent %q", name)
+}
+
+// Neighbors returns the states of the neighbors of cell i of grid, such
+// as automaton.CelAut.Neighbors.
+type Neighbors func(grid []int, i int) []int
+
+// Velocities returns the velocity of each cell of grid. previous is the
+// grid of the previous step, nil for the first one, and the step is at
+// position cyclePos in the cycle of the automaton, period being 0 when
+// the cycle is not known. neighbors is only used by AccentNeighbors.
+func (a Accent) Velocities(grid, previous []int, neighbors Neighbors, cyclePos, period int) []float64 {
+	res := make([]float64, len(grid))
+	for i := range grid {
+		res[i] = 1
+		switch a {
+		case AccentChanges:
+			if previous != nil && previous[i] == grid[i] {
+				res[i] = 0.5
+			}
+		case AccentNeighbors:
+			states := neighbors(grid, i)
+			active := 0
+			for _, state := range states {
+				if state != 0 {
+					active++
+				}
+			}
+			res[i] = 0.4 + 0.6*float64(active)/float64(len(states))
+		case AccentCycle:
+			if period > 0 {
+				res[i] = 1 - 0.5*float64(cyclePos)/float64(period)
+			}
+		}
+	}
+	return res
+}
+
+// AllVelocities returns the velocities of the cells of generations,
+// whose cycle starts at generation transient and lasts period
+// generations, period being 0 when the cycle is not known. neighbors is
+// used as by Velocities.
+func (a Accent) AllVelocities(generations [][]int, neighbors Neighbors, transient, period int) [][]float64 {
+	res := make([][]float64, len(generations))
+	var previous []int
+	for step, grid := range generations {
+		cyclePos, stepPeriod := 0, 0
+		if period > 0 && step >= transient {
+			cyclePos, stepPeriod = (step-transient)%period, period
+		}
+		res[step] = a.Velocities(grid, previous, neighbors, cyclePos, stepPeriod)
+		previous = grid
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// Decode decodes the content of a WAV, Ogg Vorbis or MP3 file to PCM at
+// SampleRate, the format being given by the extension of name.
+func Decode(name string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".wav":
+		return DecodeWAV(data)
+	case ".ogg":
+		return DecodeOgg(data)
+	case ".mp3":
+		return DecodeMP3(data)
+	}
+	return nil, fmt.Errorf("sound: unsupported file format %q", name)
+}
+
+// DecodeMP3 decodes MP3 data to PCM, resampling it to SampleRate if
+// needed.
+func DecodeMP3(data []byte) ([]byte, error) {
+	d, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := ioutil.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	return resample(pcm, d.SampleRate()), nil
+}
+
+// DecodeWAV decodes 8 or 16 bits mono or stereo PCM WAV data to PCM,
+// resampling it to SampleRate if needed.
+func DecodeWAV(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("sound: not a WAV file")
+	}
+	var channels, sampleRate, bitsPerSample int
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		if size < 0 || pos+size > len(data) {
+			size = len(data) - pos
+		}
+		chunk := data[pos : pos+size]
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 || binary.LittleEndian.Uint16(chunk[0:2]) != 1 {
+				return nil, errors.New("sound: only PCM WAV files are supported")
+			}
+			channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:16]))
+		case "data":
+			if channels < 1 || channels > 2 || (bitsPerSample != 8 && bitsPerSample != 16) || sampleRate <= 0 {
+				return nil, errors.New("sound: only 8 or 16 bits mono or stereo WAV files are supported")
+			}
+			frameSize := channels * bitsPerSample / 8
+			numSamples := len(chunk) / frameSize
+			samples := make([]float32, numSamples*channels)
+			for i := range samples {
+				if bitsPerSample == 8 {
+					samples[i] = (float32(chunk[i]) - 128) / 128
+				} else {
+					samples[i] = float32(int16(binary.LittleEndian.Uint16(chunk[2*i:]))) / 32768
+				}
+			}
+			return resample(toStereo(samples, channels), sampleRate), nil
+		}
+		pos += size + size%2
+	}
+	return nil, errors.New("sound: WAV file without data")
+}
+
+// DecodeOgg decodes Ogg Vorbis data to PCM, resampling it to SampleRate
+// if needed.
+func DecodeOgg(data []byte) ([]byte, error) {
+	samples, format, err := oggvorbis.ReadAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format.Channels < 1 || format.Channels > 2 {
+		return nil, errors.New("sound: only mono or stereo Ogg files are supported")
+	}
+	return resample(toStereo(samples, format.Channels), format.SampleRate), nil
+}
+
+// toStereo converts interleaved samples between -1 and 1 with the given
+// number of channels to 16 bits stereo PCM.
+func toStereo(samples []float32, channels int) []byte {
+	numSamples := len(samples) / channels
+	res := make([]byte, numSamples*bytesPerSample)
+	for i := 0; i < numSamples; i++ {
+		for c := 0; c < 2; c++ {
+			v := samples[i*channels+c%channels]
+			if v > 1 {
+				v = 1
+			} else if v < -1 {
+				v = -1
+			}
+			binary.LittleEndian.PutUint16(res[i*bytesPerSample+2*c:], uint16(int16(v*32767)))
+		}
+	}
+	return res
+}
+
+// resample converts pcm from sampleRate to SampleRate by linear
+// interpolation.
+func resample(pcm []byte, sampleRate int) []byte {
+	if sampleRate == SampleRate {
+		return pcm
+	}
+	inSamples := len(pcm) / bytesPerSample
+	outSamples := int(int64(inSamples) * SampleRate / int64(sampleRate))
+	res := make([]byte, outSamples*bytesPerSample)
+	for i := 0; i < outSamples; i++ {
+		pos := float64(i) * float64(sampleRate) / SampleRate
+		j := int(pos)
+		frac := pos - float64(j)
+		for c := 0; c < 2; c++ {
+			v0 := sampleAt(pcm, j, c)
+			v1 := v0
+			if j+1 < inSamples {
+				v1 = sampleAt(pcm, j+1, c)
+			}
+			v := int16(float64(v0) + frac*float64(v1-v0))
+			res[i*bytesPerSample+2*c] = byte(v)
+			res[i*bytesPerSample+2*c+1] = byte(v >> 8)
+		}
+	}
+	return res
+}
+
+// sampleAt returns the value of channel c for sample i of pcm.
+func sampleAt(pcm []byte, i, c int) int32 {
+	pos := i*bytesPerSample + 2*c
+	return int32(int16(uint16(pcm[pos]) | uint16(pcm[pos+1])<<8))
+}
@@ -0,0 +1,190 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// chunk returns a RIFF chunk, padded to an even size.
+func chunk(id string, data []byte) []byte {
+	res := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(res[4:], uint32(len(data)))
+	res = append(res, data...)
+	if len(data)%2 == 1 {
+		res = append(res, 0)
+	}
+	return res
+}
+
+// fmtChunk returns the fmt chunk of a WAV file.
+func fmtChunk(format, channels, sampleRate, bitsPerSample int) []byte {
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint16(data[0:], uint16(format))
+	binary.LittleEndian.PutUint16(data[2:], uint16(channels))
+	binary.LittleEndian.PutUint32(data[4:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(data[8:], uint32(sampleRate*channels*bitsPerSample/8))
+	binary.LittleEndian.PutUint16(data[12:], uint16(channels*bitsPerSample/8))
+	binary.LittleEndian.PutUint16(data[14:], uint16(bitsPerSample))
+	return chunk("fmt ", data)
+}
+
+// wavFile returns a WAV file made of chunks.
+func wavFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return chunk("RIFF", body)
+}
+
+// pcm16 returns 16 bits samples as little endian bytes.
+func pcm16(samples ...int16) []byte {
+	res := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(res[2*i:], uint16(s))
+	}
+	return res
+}
+
+func TestDecodeWAV(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{
+			"8 bits mono",
+			wavFile(fmtChunk(1, 1, SampleRate, 8), chunk("data", []byte{128, 255, 0})),
+			pcm16(0, 0, 32511, 32511, -32767, -32767),
+		},
+		{
+			"16 bits stereo",
+			wavFile(fmtChunk(1, 2, SampleRate, 16), chunk("data", pcm16(0, 16384, -16384, 0))),
+			pcm16(0, 16383, -16383, 0),
+		},
+		{
+			"odd chunk before fmt",
+			wavFile(chunk("LIST", []byte{1, 2, 3}), fmtChunk(1, 1, SampleRate, 16), chunk("data", pcm16(16384))),
+			pcm16(16383, 16383),
+		},
+		{
+			"incomplete frame",
+			wavFile(fmtChunk(1, 2, SampleRate, 16), chunk("data", pcm16(16384, 16384, 0))),
+			pcm16(16383, 16383),
+		},
+		{
+			"resampled",
+			wavFile(fmtChunk(1, 1, SampleRate/2, 16), chunk("data", pcm16(0, 16384))),
+			pcm16(0, 0, 8191, 8191, 16383, 16383, 16383, 16383),
+		},
+	}
+	for _, test := range tests {
+		got, err := DecodeWAV(test.data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, pcm16Values(got), pcm16Values(test.want))
+		}
+	}
+}
+
+func TestDecodeWAVTruncated(t *testing.T) {
+	data := wavFile(fmtChunk(1, 1, SampleRate, 16), chunk("data", pcm16(16384, 16384)))
+	// the size of the data chunk is kept, but its last sample is lost
+	got, err := DecodeWAV(data[:len(data)-2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pcm16(16383, 16383); !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", pcm16Values(got), pcm16Values(want))
+	}
+}
+
+func TestDecodeWAVErrors(t *testing.T) {
+	data := chunk("data", pcm16(0, 0))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not RIFF", append([]byte("RIFX"), wavFile(fmtChunk(1, 1, SampleRate, 16), data)[4:]...)},
+		{"not WAVE", append(chunk("RIFF", nil), []byte("AVI ")...)},
+		{"float", wavFile(fmtChunk(3, 1, SampleRate, 32), data)},
+		{"short fmt", wavFile(chunk("fmt ", []byte{1, 0, 1, 0}), data)},
+		{"24 bits", wavFile(fmtChunk(1, 1, SampleRate, 24), data)},
+		{"3 channels", wavFile(fmtChunk(1, 3, SampleRate, 16), data)},
+		{"no sample rate", wavFile(fmtChunk(1, 1, 0, 16), data)},
+		{"data before fmt", wavFile(data, fmtChunk(1, 1, SampleRate, 16))},
+		{"no data", wavFile(fmtChunk(1, 1, SampleRate, 16))},
+	}
+	for _, test := range tests {
+		if _, err := DecodeWAV(test.data); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data := wavFile(fmtChunk(1, 1, SampleRate, 16), chunk("data", pcm16(0)))
+	if _, err := Decode("son.WAV", data); err != nil {
+		t.Errorf("son.WAV: %v", err)
+	}
+	if _, err := Decode("son.flac", data); err == nil {
+		t.Error("son.flac: no error")
+	}
+	if _, err := Decode("son.mp3", data); err == nil {
+		t.Error("WAV data decoded as MP3")
+	}
+}
+
+func TestResample(t *testing.T) {
+	pcm := pcm16(0, 0, 100, -100, 200, -200, 300, -300)
+	tests := []struct {
+		sampleRate int
+		want       []byte
+	}{
+		{SampleRate, pcm},
+		{SampleRate / 2, pcm16(0, 0, 50, -50, 100, -100, 150, -150, 200, -200, 250, -250, 300, -300, 300, -300)},
+		{SampleRate * 2, pcm16(0, 0, 200, -200)},
+		{SampleRate * 4, pcm16(0, 0)},
+		{SampleRate * 8, nil},
+	}
+	for _, test := range tests {
+		got := resample(pcm, test.sampleRate)
+		if len(got) == 0 && len(test.want) == 0 {
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("sample rate %d: got %v, want %v", test.sampleRate, pcm16Values(got), pcm16Values(test.want))
+		}
+	}
+}
+
+// pcm16Values returns the 16 bits samples of pcm.
+func pcm16Values(pcm []byte) []int16 {
+	res := make([]int16, len(pcm)/2)
+	for i := range res {
+		res[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	return res
+}
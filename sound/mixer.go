@@ -0,0 +1,168 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"sort"
+)
+
+// DefaultMaxVoices is the number of sounds each state can play at the
+// same step by default.
+const DefaultMaxVoices = 8
+
+// Channel holds the mixer settings of the sounds of a state.
+type Channel struct {
+	// Volume is between 0 and 1.
+	Volume float64 `json:"volume"`
+	// Pan is between -1 (left) and 1 (right).
+	Pan  float64 `json:"pan"`
+	Mute bool    `json:"mute,omitempty"`
+	Solo bool    `json:"solo,omitempty"`
+}
+
+// DefaultChannel plays sounds unchanged.
+var DefaultChannel = Channel{Volume: 1}
+
+// Mixer holds the channel of each non-zero state, Channels[s-1] for
+// state s. States without a channel use DefaultChannel.
+type Mixer struct {
+	Channels []Channel
+	// MaxVoices is the number of different sounds each state can play at
+	// the same step, the softer ones being dropped. 0 means no limit.
+	MaxVoices int
+}
+
+// NewMixer returns a mixer playing the sounds of numStates non-zero
+// states unchanged, with DefaultMaxVoices voices per state.
+func NewMixer(numStates int) Mixer {
+	m := Mixer{Channels: make([]Channel, numStates), MaxVoices: DefaultMaxVoices}
+	for i := range m.Channels {
+		m.Channels[i] = DefaultChannel
+	}
+	return m
+}
+
+// Channel returns the channel of state.
+func (m Mixer) Channel(state int) Channel {
+	if state < 1 || state > len(m.Channels) {
+		return DefaultChannel
+	}
+	return m.Channels[state-1]
+}
+
+// Gains returns the gains of the left and right channels for the sounds
+// of state. When some states are soloed, the other ones are silent.
+func (m Mixer) Gains(state int) (left, right float64) {
+	c := m.Channel(state)
+	if c.Mute || (m.hasSolo() && !c.Solo) {
+		return 0, 0
+	}
+	left, right = c.Volume, c.Volume
+	if c.Pan > 0 {
+		left *= 1 - c.Pan
+	} else {
+		right *= 1 + c.Pan
+	}
+	return left, right
+}
+
+func (m Mixer) hasSolo() bool {
+	for _, c := range m.Channels {
+		if c.Solo {
+			return true
+		}
+	}
+	return false
+}
+
+// Hit is a sound played by a step, with the gains of its left and right
+// channels.
+type Hit struct {
+	Sound       []byte
+	Left, Right float64
+}
+
+// StepHits returns the sounds played by grid, cell i in state s playing
+// cellSounds[i][s-1] at velocities[i] through the channel of s in m.
+// Without velocities, cells are played at full velocity. Cells playing
+// the same sound in the same state give a single hit with their gains
+// summed, and each state keeps at most m.MaxVoices hits, the loudest.
+func StepHits(grid []int, cellSounds [][][]byte, m Mixer, velocities []float64) []Hit {
+	type voiceKey struct {
+		state int
+		sound *byte
+	}
+	var hits []Hit
+	var states []int
+	grouped := make(map[voiceKey]int)
+	for cell, state := range grid {
+		if state == 0 || cell >= len(cellSounds) || state > len(cellSounds[cell]) {
+			continue
+		}
+		left, right := m.Gains(state)
+		if cell < len(velocities) {
+			left *= velocities[cell]
+			right *= velocities[cell]
+		}
+		sound := cellSounds[cell][state-1]
+		if (left == 0 && right == 0) || len(sound) == 0 {
+			continue
+		}
+		key := voiceKey{state, &sound[0]}
+		if i, ok := grouped[key]; ok && len(hits[i].Sound) == len(sound) {
+			hits[i].Left += left
+			hits[i].Right += right
+			continue
+		}
+		grouped[key] = len(hits)
+		hits = append(hits, Hit{sound, left, right})
+		states = append(states, state)
+	}
+	if m.MaxVoices <= 0 {
+		return hits
+	}
+	return limitVoices(hits, states, m.MaxVoices)
+}
+
+// limitVoices keeps the maxVoices loudest hits of each state, hits[i]
+// being played by states[i], in their order.
+func limitVoices(hits []Hit, states []int, maxVoices int) []Hit {
+	order := make([]int, len(hits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		hi, hj := hits[order[i]], hits[order[j]]
+		return hi.Left+hi.Right > hj.Left+hj.Right
+	})
+	kept := make([]bool, len(hits))
+	voices := make(map[int]int)
+	for _, i := range order {
+		if voices[states[i]] < maxVoices {
+			voices[states[i]]++
+			kept[i] = true
+		}
+	}
+	res := hits[:0]
+	for i, hit := range hits {
+		if kept[i] {
+			res = append(res, hit)
+		}
+	}
+	return res
+}
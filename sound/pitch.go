@@ -0,0 +1,158 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PitchMode tells how the position of a cell changes the pitch of its
+// sounds.
+type PitchMode int
+
+const (
+	// NoPitch plays the sounds unchanged.
+	NoPitch PitchMode = iota
+	// StateTimbre plays the sound of the state of the cell at the pitch
+	// given by the position of the cell.
+	StateTimbre
+	// StateOctave plays the first sound at the pitch given by the
+	// position of the cell, one octave higher for each state above 1.
+	StateOctave
+)
+
+var pitchModeNames = []string{"none", "timbre", "octave"}
+
+func (m PitchMode) String() string {
+	if m < 0 || int(m) >= len(pitchModeNames) {
+		return fmt.Sprint("PitchMode(", int(m), ")")
+	}
+	return pitchModeNames[m]
+}
+
+// ParsePitchMode returns the pitch mode with the given name.
+func ParsePitchMode(name string) (PitchMode, error) {
+	for i, n := range pitchModeNames {
+		if n == name {
+			return PitchMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("sound: unknown pitch mode %q", name)
+}
+
+// Scales are the predefined scales, as semitones above the root.
+var Scales = []struct {
+	Name  string
+	Steps []int
+}{
+	{"major", []int{0, 2, 4, 5, 7, 9, 11}},
+	{"pentatonic", []int{0, 2, 4, 7, 9}},
+	{"chromatic", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+}
+
+// ParseScale returns the predefined scale with the given name, or the
+// custom scale given as a comma separated list of increasing semitones
+// between 0 and 11, for example "0,3,5,7,10".
+func ParseScale(spec string) ([]int, error) {
+	for _, scale := range Scales {
+		if scale.Name == spec {
+			return scale.Steps, nil
+		}
+	}
+	var steps []int
+	for _, field := range strings.Split(spec, ",") {
+		step, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("sound: invalid scale %q", spec)
+		}
+		steps = append(steps, step)
+	}
+	return steps, CheckScale(steps)
+}
+
+// CheckScale tells if steps is a valid scale.
+func CheckScale(steps []int) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("sound: empty scale")
+	}
+	for i, step := range steps {
+		if step < 0 || step > 11 || (i > 0 && step <= steps[i-1]) {
+			return fmt.Errorf("sound: invalid scale %v", steps)
+		}
+	}
+	return nil
+}
+
+// PitchMap maps the cells of an automaton to pitches.
+type PitchMap struct {
+	Mode  PitchMode
+	Scale []int
+}
+
+// Semitones returns the transposition in semitones of the sound played
+// by the given cell among numCells, in the given state. Cells play the
+// successive degrees of the scale, the middle cell playing its root.
+func (p PitchMap) Semitones(cell, numCells, state int) int {
+	res := 0
+	if p.Mode != NoPitch && len(p.Scale) > 0 {
+		degree := cell - numCells/2
+		octave := degree / len(p.Scale)
+		if degree%len(p.Scale) < 0 {
+			octave--
+		}
+		res = 12*octave + p.Scale[degree-octave*len(p.Scale)]
+	}
+	if p.Mode == StateOctave {
+		res += 12 * (state - 1)
+	}
+	return res
+}
+
+// CellSounds returns the sounds played by each of numCells cells, the
+// sound of cell i in state s being res[i][s-1].
+func (p PitchMap) CellSounds(sounds [][]byte, numCells int) [][][]byte {
+	transposed := make(map[[2]int][]byte)
+	res := make([][][]byte, numCells)
+	for cell := range res {
+		res[cell] = make([][]byte, len(sounds))
+		for state := 1; state <= len(sounds); state++ {
+			source := state - 1
+			if p.Mode == StateOctave {
+				source = 0
+			}
+			key := [2]int{source, p.Semitones(cell, numCells, state)}
+			if _, ok := transposed[key]; !ok {
+				transposed[key] = Transpose(sounds[source], key[1])
+			}
+			res[cell][state-1] = transposed[key]
+		}
+	}
+	return res
+}
+
+// Transpose changes the pitch of pcm by the given number of semitones,
+// by changing its speed.
+func Transpose(pcm []byte, semitones int) []byte {
+	if semitones == 0 {
+		return pcm
+	}
+	return resample(pcm, int(math.Round(SampleRate*math.Pow(2, float64(semitones)/12))))
+}
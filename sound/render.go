@@ -0,0 +1,155 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package sound renders the rhythms generated by GRAC automata into
+// PCM audio without depending on any audio device.
+//
+// All the PCM data handled by this package is 16-bit little endian
+// stereo at SampleRate.
+package sound
+
+import (
+	"math"
+
+	"github.com/loig/grac/groove"
+)
+
+const (
+	SampleRate     = 44100
+	bytesPerSample = 4
+)
+
+// StepLength returns the number of samples of a step at tempo steps
+// per minute.
+func StepLength(tempo float64) float64 {
+	return SampleRate * 60 / tempo
+}
+
+// stepStart returns the position of the first sample of a step.
+func stepStart(step int, tempo float64, g groove.Groove) int {
+	return int(math.Max(0, math.Round((float64(step)+g.Offset(step))*StepLength(tempo))))
+}
+
+// Render mixes the sounds played by generations, one generation per
+// step at tempo steps per minute. Cells in state s play sounds[s-1].
+// As in live playback, a sound is cut by the next step, except on the
+// last one.
+func Render(generations [][]int, sounds [][]byte, tempo float64) []byte {
+	numCells := 0
+	if len(generations) > 0 {
+		numCells = len(generations[0])
+	}
+	return RenderCells(generations, PitchMap{}.CellSounds(sounds, numCells), Options{Tempo: tempo})
+}
+
+// Options describe how RenderCells plays the generations.
+type Options struct {
+	// Tempo is the number of steps per minute.
+	Tempo float64
+	// Groove shifts the start of the steps.
+	Groove groove.Groove
+	Mixer  Mixer
+	// Velocities gives the velocity of each cell at each step, see
+	// Accent.AllVelocities. Without it, cells are played at full
+	// velocity.
+	Velocities [][]float64
+}
+
+// RenderCells is like Render, but each cell plays its own sounds, cell
+// i in state s playing cellSounds[i][s-1], as given by opts.
+func RenderCells(generations [][]int, cellSounds [][][]byte, opts Options) []byte {
+	tempo, g := opts.Tempo, opts.Groove
+	longest := 0
+	for _, sounds := range cellSounds {
+		for _, sound := range sounds {
+			if len(sound)/bytesPerSample > longest {
+				longest = len(sound) / bytesPerSample
+			}
+		}
+	}
+	numSamples := 0
+	if len(generations) > 0 {
+		numSamples = stepStart(len(generations)-1, tempo, g) + longest
+	}
+
+	mix := make([]int32, 2*numSamples)
+	for step, grid := range generations {
+		var velocities []float64
+		if step < len(opts.Velocities) {
+			velocities = opts.Velocities[step]
+		}
+		start := stepStart(step, tempo, g)
+		length := stepStart(step+1, tempo, g) - start
+		if step == len(generations)-1 {
+			length = longest
+		}
+		for _, hit := range StepHits(grid, cellSounds, opts.Mixer, velocities) {
+			addSound(mix[2*start:], hit, length)
+		}
+	}
+
+	return toPCM(mix)
+}
+
+// addSound adds at most length samples of the sound of hit at the start
+// of mix.
+func addSound(mix []int32, hit Hit, length int) {
+	sound := hit.Sound
+	if len(sound)/bytesPerSample < length {
+		length = len(sound) / bytesPerSample
+	}
+	gains := [2]float64{hit.Left, hit.Right}
+	for i := 0; i < 2*length && i < len(mix); i++ {
+		v := int16(uint16(sound[2*i]) | uint16(sound[2*i+1])<<8)
+		if gains[i%2] == 1 {
+			mix[i] += int32(v)
+		} else {
+			mix[i] += int32(float64(v) * gains[i%2])
+		}
+	}
+}
+
+// limitThreshold is the level above which the limiter of toPCM starts
+// to compress the mix.
+const limitThreshold = 24576
+
+// toPCM converts mixed samples to PCM. Samples louder than
+// limitThreshold are softly compressed so that they never clip.
+func toPCM(mix []int32) []byte {
+	res := make([]byte, 2*len(mix))
+	for i, v := range mix {
+		if v > limitThreshold || v < -limitThreshold {
+			v = softLimit(v)
+		}
+		res[2*i] = byte(v)
+		res[2*i+1] = byte(v >> 8)
+	}
+	return res
+}
+
+// softLimit bends a sample louder than limitThreshold towards the
+// maximum level.
+func softLimit(v int32) int32 {
+	const headroom = 32767 - limitThreshold
+	sign := int32(1)
+	if v < 0 {
+		sign = -1
+	}
+	excess := float64(sign*v - limitThreshold)
+	return sign * int32(limitThreshold+headroom*math.Tanh(excess/headroom))
+}
@@ -0,0 +1,238 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/loig/grac/groove"
+)
+
+// Scheduler is an endless PCM stream, to be given to an audio player,
+// that plays steps at a given tempo, shifted by a groove. Each step
+// starts at an exact sample position, whatever the tempo, and, as in
+// Render, cuts the sounds of the previous one.
+//
+// The sounds of a step are asked to the next function given to
+// NewScheduler when the stream reaches the step, from the goroutine
+// reading the stream. This happens before the step is heard, by the
+// latency of the audio player, so the time at which it is heard is
+// also given to next, for things that must happen along with the
+// sounds.
+type Scheduler struct {
+	mu   sync.Mutex
+	next func(step int, t StepTime) []Hit
+	// tempo is the number of steps per minute
+	tempo   float64
+	groove  groove.Groove
+	playing bool
+	// step is the number of the next step since the last Start
+	step int
+	// pos is the position of the next sample read, lastBeat and
+	// nextBeat are the positions of the start of the last and of the
+	// next steps without groove, and nextStep is the position of the
+	// start of the next step
+	pos      int64
+	lastBeat float64
+	nextBeat float64
+	nextStep float64
+	voices   []voice
+	// latency is the time between the reading of a sample and the moment
+	// it is heard, the sample at originPos being heard at originTime
+	latency    time.Duration
+	originPos  int64
+	originTime time.Time
+}
+
+// StepTime tells when a step is heard.
+type StepTime struct {
+	// At is the start of the step and Beat the start it would have
+	// without groove.
+	At   time.Time
+	Beat time.Time
+	// Length is the length of the steps at the current tempo.
+	Length time.Duration
+}
+
+// voice is a sound being played, from the sample at pos.
+type voice struct {
+	hit Hit
+	pos int
+}
+
+// NewScheduler returns a stopped scheduler. When playing, next is
+// called at the start of each step, numbered from 0 since the last call
+// to Start, and returns the sounds to play. latency is the time it takes
+// to the audio player to play the samples it reads.
+func NewScheduler(next func(step int, t StepTime) []Hit, latency time.Duration) *Scheduler {
+	return &Scheduler{next: next, tempo: 60, latency: latency}
+}
+
+// Start starts playing at tempo steps per minute, from step 0 that
+// starts immediately.
+func (s *Scheduler) Start(tempo float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tempo = tempo
+	s.playing = true
+	s.step = 0
+	s.nextBeat = float64(s.pos)
+	s.scheduleNext()
+}
+
+// Stop stops playing new steps. The sounds already started ring out.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playing = false
+}
+
+// SetTempo changes the tempo, the next step starting a step length
+// after the start of the last one.
+func (s *Scheduler) SetTempo(tempo float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tempo = tempo
+	if s.step > 0 {
+		s.nextBeat = s.lastBeat + s.stepLength()
+		s.scheduleNext()
+	}
+}
+
+// Sync starts a step now, to follow an external clock. A step that
+// started less than half a step length ago is taken as this one.
+func (s *Scheduler) Sync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.playing {
+		return
+	}
+	if s.step > 0 && float64(s.pos)-s.lastBeat < s.stepLength()/2 {
+		s.lastBeat = float64(s.pos)
+		s.nextBeat = s.lastBeat + s.stepLength()
+	} else {
+		s.nextBeat = float64(s.pos)
+	}
+	s.scheduleNext()
+}
+
+// Playing tells whether the scheduler plays steps.
+func (s *Scheduler) Playing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.playing
+}
+
+// SetGroove changes the groove, from the next step.
+func (s *Scheduler) SetGroove(g groove.Groove) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groove = g
+	s.scheduleNext()
+}
+
+// scheduleNext computes the start of the next step, which cannot be in
+// the past.
+func (s *Scheduler) scheduleNext() {
+	s.nextStep = math.Max(s.nextBeat+s.groove.Offset(s.step)*s.stepLength(), float64(s.pos))
+}
+
+// Tempo returns the tempo, in steps per minute.
+func (s *Scheduler) Tempo() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tempo
+}
+
+func (s *Scheduler) stepLength() float64 {
+	return SampleRate * 60 / s.tempo
+}
+
+// syncTime updates the time at which the samples are heard, knowing
+// that the sample at s.pos is read now. As a sample cannot be read
+// before the player has room for it, it is heard at most the latency
+// after it is read: the earliest time found is kept, unless the player
+// ran out of samples and the time found is already past.
+func (s *Scheduler) syncTime(now time.Time) {
+	heard := now.Add(s.latency)
+	if expected := s.sampleTime(float64(s.pos)); s.originTime.IsZero() || heard.Before(expected) || expected.Before(now) {
+		s.originPos = s.pos
+		s.originTime = heard
+	}
+}
+
+// sampleTime returns the time at which the sample at pos is heard.
+func (s *Scheduler) sampleTime(pos float64) time.Time {
+	return s.originTime.Add(time.Duration((pos - float64(s.originPos)) / SampleRate * float64(time.Second)))
+}
+
+// Read mixes the sounds of the steps into p.
+func (s *Scheduler) Read(p []byte) (int, error) {
+	numSamples := len(p) / bytesPerSample
+	mix := make([]int32, 2*numSamples)
+	s.mu.Lock()
+	s.syncTime(time.Now())
+	for done := 0; done < numSamples; {
+		if s.playing && float64(s.pos) >= s.nextStep {
+			step := s.step
+			t := StepTime{
+				At:     s.sampleTime(float64(s.pos)),
+				Beat:   s.sampleTime(s.nextBeat),
+				Length: time.Duration(s.stepLength() / SampleRate * float64(time.Second)),
+			}
+			s.step++
+			s.lastBeat = s.nextBeat
+			s.nextBeat += s.stepLength()
+			s.scheduleNext()
+			// next may need locks held by callers of the other methods
+			s.mu.Unlock()
+			hits := s.next(step, t)
+			s.mu.Lock()
+			s.voices = s.voices[:0]
+			for _, hit := range hits {
+				if len(hit.Sound) >= bytesPerSample {
+					s.voices = append(s.voices, voice{hit: hit})
+				}
+			}
+		}
+		length := numSamples - done
+		if s.playing {
+			if untilStep := int(int64(math.Ceil(s.nextStep)) - s.pos); untilStep < length {
+				length = untilStep
+			}
+		}
+		playing := s.voices[:0]
+		for _, v := range s.voices {
+			hit := v.hit
+			hit.Sound = hit.Sound[v.pos*bytesPerSample:]
+			addSound(mix[2*done:], hit, length)
+			v.pos += length
+			if v.pos*bytesPerSample < len(v.hit.Sound) {
+				playing = append(playing, v)
+			}
+		}
+		s.voices = playing
+		done += length
+		s.pos += int64(length)
+	}
+	s.mu.Unlock()
+	copy(p, toPCM(mix))
+	return numSamples * bytesPerSample, nil
+}
@@ -0,0 +1,96 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SoundSet is a set of sounds read from a directory, one file per
+// non-zero state in the alphabetical order of the file names.
+type SoundSet struct {
+	Name  string
+	Files []File
+}
+
+// File is the undecoded content of a sound file. Its format is given by
+// the extension of its name.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// IsSoundFile tells if name has the extension of a supported format:
+// .wav, .ogg or .mp3.
+func IsSoundFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".wav", ".ogg", ".mp3":
+		return true
+	}
+	return false
+}
+
+// ReadSoundSets reads the sound sets in dir, one per subdirectory, in
+// the alphabetical order of their names. Subdirectories without sound
+// files are ignored.
+func ReadSoundSets(dir string) ([]SoundSet, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sets []SoundSet
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		set, err := readSoundSet(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(set.Files) > 0 {
+			sets = append(sets, set)
+		}
+	}
+	return sets, nil
+}
+
+func readSoundSet(dir string) (SoundSet, error) {
+	set := SoundSet{Name: filepath.Base(dir)}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return set, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && IsSoundFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return set, err
+		}
+		set.Files = append(set.Files, File{Name: name, Data: data})
+	}
+	return set, nil
+}
@@ -0,0 +1,173 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Instrument is a kind of synthesized drum voice.
+type Instrument int
+
+const (
+	Kick Instrument = iota
+	Snare
+	HiHat
+	Clap
+	Tone
+)
+
+var instrumentNames = []string{"kick", "snare", "hihat", "clap", "tone"}
+
+func (i Instrument) String() string {
+	if i < 0 || int(i) >= len(instrumentNames) {
+		return fmt.Sprint("Instrument(", int(i), ")")
+	}
+	return instrumentNames[i]
+}
+
+// ParseInstrument returns the instrument with the given name.
+func ParseInstrument(name string) (Instrument, error) {
+	for i, n := range instrumentNames {
+		if n == name {
+			return Instrument(i), nil
+		}
+	}
+	return 0, fmt.Errorf("sound: unknown instrument %q", name)
+}
+
+// Voice is a synthesized drum voice. Pitch is the frequency in Hz of
+// the tone of the voice, or of the noise filter for hi-hats and claps,
+// and Decay is the length of the sound in seconds.
+type Voice struct {
+	Instrument Instrument
+	Pitch      float64
+	Decay      float64
+}
+
+// DefaultVoices are the voices of the synthesized sound set, one per
+// non-zero state.
+var DefaultVoices = []Voice{
+	{Kick, 50, 0.4},
+	{Snare, 180, 0.25},
+	{HiHat, 7000, 0.08},
+	{Clap, 1200, 0.3},
+}
+
+// MaxDecay is the maximal length of a synthesized sound, in seconds.
+const MaxDecay = 5
+
+func (v Voice) String() string {
+	return fmt.Sprint(v.Instrument, ":", strconv.FormatFloat(v.Pitch, 'g', -1, 64), ":", strconv.FormatFloat(v.Decay, 'g', -1, 64))
+}
+
+// ParseVoices reads a comma separated list of voices, each given as
+// instrument:pitch:decay, for example "kick:50:0.4,hihat:7000:0.08".
+// Pitch and decay can be omitted to use the values of DefaultVoices
+// for this instrument, or of a 440 Hz tone lasting 0.5 second.
+func ParseVoices(spec string) ([]Voice, error) {
+	var voices []Voice
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("sound: invalid voice %q", field)
+		}
+		instrument, err := ParseInstrument(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		voice := Voice{instrument, 440, 0.5}
+		for _, v := range DefaultVoices {
+			if v.Instrument == instrument {
+				voice = v
+				break
+			}
+		}
+		if len(parts) > 1 {
+			if voice.Pitch, err = strconv.ParseFloat(parts[1], 64); err != nil || voice.Pitch <= 0 || voice.Pitch >= SampleRate/2 {
+				return nil, fmt.Errorf("sound: invalid pitch in voice %q", field)
+			}
+		}
+		if len(parts) > 2 {
+			if voice.Decay, err = strconv.ParseFloat(parts[2], 64); err != nil || voice.Decay <= 0 || voice.Decay > MaxDecay {
+				return nil, fmt.Errorf("sound: invalid decay in voice %q", field)
+			}
+		}
+		voices = append(voices, voice)
+	}
+	return voices, nil
+}
+
+// Synthesize generates the sound of the voice as 16 bits stereo PCM at
+// SampleRate.
+func (v Voice) Synthesize() []byte {
+	decay := math.Min(math.Max(v.Decay, 0.001), MaxDecay)
+	numSamples := int(decay * SampleRate)
+	// the noise is always the same so that a voice always sounds the same
+	noise := rand.New(rand.NewSource(int64(v.Instrument) + 1))
+	samples := make([]float32, numSamples)
+	phase := 0.0
+	lowPass := 0.0
+	// smoothing factor of a one pole filter at frequency v.Pitch
+	alpha := 1 - math.Exp(-2*math.Pi*v.Pitch/SampleRate)
+	for i := range samples {
+		t := float64(i) / SampleRate
+		env := math.Exp(-6.9 * t / decay)
+		var s float64
+		switch v.Instrument {
+		case Kick:
+			// the pitch falls quickly from three times its value
+			phase += 2 * math.Pi * v.Pitch * (1 + 2*math.Exp(-t/0.03)) / SampleRate
+			s = math.Sin(phase) * env
+		case Snare:
+			phase += 2 * math.Pi * v.Pitch / SampleRate
+			s = 0.5*math.Sin(phase)*math.Exp(-6.9*t/(decay/3)) + 0.6*(2*noise.Float64()-1)*env
+		case HiHat:
+			n := 2*noise.Float64() - 1
+			lowPass += alpha * (n - lowPass)
+			s = (n - lowPass) * env
+		case Clap:
+			n := 2*noise.Float64() - 1
+			lowPass += alpha * (n - lowPass)
+			// three short bursts before the tail
+			burst := math.Exp(-6.9 * math.Mod(math.Min(t, 0.03), 0.01) / 0.01)
+			if t >= 0.03 {
+				burst = env
+			}
+			s = 2 * (n - lowPass) * burst
+		case Tone:
+			phase += 2 * math.Pi * v.Pitch / SampleRate
+			s = (0.8*math.Sin(phase) + 0.2*math.Sin(2*phase)) * env
+		}
+		samples[i] = float32(0.8 * s)
+	}
+	return toStereo(samples, 1)
+}
+
+// SynthesizeAll generates the sounds of voices.
+func SynthesizeAll(voices []Voice) [][]byte {
+	sounds := make([][]byte, len(voices))
+	for i, v := range voices {
+		sounds[i] = v.Synthesize()
+	}
+	return sounds
+}
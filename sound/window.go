@@ -0,0 +1,155 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Window selects the cells that are heard, so that a large automaton can
+// play a few voices. The zero value hears all the cells.
+type Window struct {
+	// Cells are the audible cells. All the cells are audible when it is
+	// empty.
+	Cells []int
+	// Voices gives, when not empty, the voice of each of Cells: Cells[i]
+	// plays the sound of state Voices[i] whatever its non-zero state,
+	// or the sound of its state when Voices[i] is 0.
+	Voices []int
+}
+
+// ContiguousWindow returns a window hearing width cells from start on a
+// ring of numCells cells. With routed, these cells play voices 1 to
+// numVoices in turn.
+func ContiguousWindow(start, width, numCells int, routed bool, numVoices int) Window {
+	var w Window
+	for i := 0; i < width && i < numCells; i++ {
+		w.Cells = append(w.Cells, ((start+i)%numCells+numCells)%numCells)
+		if routed {
+			w.Voices = append(w.Voices, i%numVoices+1)
+		}
+	}
+	return w
+}
+
+// ParseWindow reads a window given as a list of cells numbered from 1,
+// such as "5-8" or "1,5,9". A cell followed by ":v", such as "5:2",
+// plays voice v. An empty s hears all the cells.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	if strings.TrimSpace(s) == "" {
+		return w, nil
+	}
+	routed := false
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		voice := 0
+		if i := strings.Index(item, ":"); i >= 0 {
+			v, err := strconv.Atoi(item[i+1:])
+			if err != nil || v < 1 {
+				return Window{}, fmt.Errorf("sound: invalid voice in %q", item)
+			}
+			voice = v
+			routed = true
+			item = item[:i]
+		}
+		first, last := item, item
+		if i := strings.Index(item, "-"); i > 0 {
+			first, last = item[:i], item[i+1:]
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || from < 1 || to < from {
+			return Window{}, fmt.Errorf("sound: invalid cells %q", item)
+		}
+		for cell := from; cell <= to; cell++ {
+			w.Cells = append(w.Cells, cell-1)
+			w.Voices = append(w.Voices, voice)
+		}
+	}
+	if !routed {
+		w.Voices = nil
+	}
+	return w, nil
+}
+
+// Check returns an error if w does not fit an automaton of numCells
+// cells playing numVoices voices.
+func (w Window) Check(numCells, numVoices int) error {
+	if len(w.Voices) > 0 && len(w.Voices) != len(w.Cells) {
+		return fmt.Errorf("sound: %d voices for %d cells", len(w.Voices), len(w.Cells))
+	}
+	for _, cell := range w.Cells {
+		if cell < 0 || cell >= numCells {
+			return fmt.Errorf("sound: invalid cell %d", cell+1)
+		}
+	}
+	for _, voice := range w.Voices {
+		if voice < 0 || voice > numVoices {
+			return fmt.Errorf("sound: invalid voice %d", voice)
+		}
+	}
+	return nil
+}
+
+// Audible tells whether cell is heard.
+func (w Window) Audible(cell int) bool {
+	if len(w.Cells) == 0 {
+		return true
+	}
+	for _, c := range w.Cells {
+		if c == cell {
+			return true
+		}
+	}
+	return false
+}
+
+// Grid returns grid as it is heard: the cells out of the window are in
+// state 0 and the active cells routed to a voice are in the state of
+// their voice.
+func (w Window) Grid(grid []int) []int {
+	if len(w.Cells) == 0 {
+		return grid
+	}
+	res := make([]int, len(grid))
+	for i, cell := range w.Cells {
+		if cell >= len(grid) || grid[cell] == 0 {
+			continue
+		}
+		res[cell] = grid[cell]
+		if i < len(w.Voices) && w.Voices[i] > 0 {
+			res[cell] = w.Voices[i]
+		}
+	}
+	return res
+}
+
+// Generations returns generations as they are heard, see Grid.
+func (w Window) Generations(generations [][]int) [][]int {
+	if len(w.Cells) == 0 {
+		return generations
+	}
+	res := make([][]int, len(generations))
+	for i, grid := range generations {
+		res[i] = w.Grid(grid)
+	}
+	return res
+}
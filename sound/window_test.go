@@ -0,0 +1,141 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package sound
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Window
+	}{
+		{"", Window{}},
+		{" ", Window{}},
+		{"3", Window{Cells: []int{2}}},
+		{"5-8", Window{Cells: []int{4, 5, 6, 7}}},
+		{"1,5,9", Window{Cells: []int{0, 4, 8}}},
+		{"1, 3-4 ,9", Window{Cells: []int{0, 2, 3, 8}}},
+		{"5:2", Window{Cells: []int{4}, Voices: []int{2}}},
+		{"1:1,2-3:3,4", Window{Cells: []int{0, 1, 2, 3}, Voices: []int{1, 3, 3, 0}}},
+	}
+	for _, test := range tests {
+		got, err := ParseWindow(test.s)
+		if err != nil {
+			t.Errorf("ParseWindow(%q): %v", test.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseWindow(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, s := range []string{"0", "-1", "a", "1,", "8-5", "1-", "-", "1-2-3", "5:", "5:0", "5:-1", "5:x", "1;2"} {
+		if w, err := ParseWindow(s); err == nil {
+			t.Errorf("ParseWindow(%q) = %v, no error", s, w)
+		}
+	}
+}
+
+func TestWindowCheck(t *testing.T) {
+	tests := []struct {
+		window Window
+		valid  bool
+	}{
+		{Window{}, true},
+		{Window{Cells: []int{0, 9}}, true},
+		{Window{Cells: []int{10}}, false},
+		{Window{Cells: []int{-1}}, false},
+		{Window{Cells: []int{0, 1}, Voices: []int{0, 3}}, true},
+		{Window{Cells: []int{0, 1}, Voices: []int{4, 1}}, false},
+		{Window{Cells: []int{0, 1}, Voices: []int{1}}, false},
+	}
+	for _, test := range tests {
+		if err := test.window.Check(10, 3); (err == nil) != test.valid {
+			t.Errorf("%v.Check(10, 3) = %v, want valid %v", test.window, err, test.valid)
+		}
+	}
+}
+
+func TestWindowGrid(t *testing.T) {
+	grid := []int{1, 2, 0, 3, 1, 2}
+	tests := []struct {
+		window Window
+		want   []int
+	}{
+		{Window{}, grid},
+		{Window{Cells: []int{1, 2, 3}}, []int{0, 2, 0, 3, 0, 0}},
+		{Window{Cells: []int{5, 0}}, []int{1, 0, 0, 0, 0, 2}},
+		{Window{Cells: []int{0, 2, 3, 4}, Voices: []int{2, 1, 0, 3}}, []int{2, 0, 0, 3, 3, 0}},
+		// cells out of the grid are not heard
+		{Window{Cells: []int{4, 6, 10}}, []int{0, 0, 0, 0, 1, 0}},
+		{ContiguousWindow(4, 3, 6, true, 2), []int{1, 0, 0, 0, 1, 2}},
+	}
+	for _, test := range tests {
+		if got := test.window.Grid(grid); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v.Grid(%v) = %v, want %v", test.window, grid, got, test.want)
+		}
+	}
+}
+
+func TestWindowAudible(t *testing.T) {
+	w := Window{Cells: []int{1, 3}}
+	for cell, want := range []bool{false, true, false, true, false} {
+		if got := w.Audible(cell); got != want {
+			t.Errorf("Audible(%d) = %v, want %v", cell, got, want)
+		}
+		if !(Window{}).Audible(cell) {
+			t.Errorf("cell %d not audible in the empty window", cell)
+		}
+	}
+}
+
+func TestContiguousWindow(t *testing.T) {
+	tests := []struct {
+		start, width, numCells int
+		routed                 bool
+		want                   Window
+	}{
+		{2, 3, 10, false, Window{Cells: []int{2, 3, 4}}},
+		{8, 4, 10, false, Window{Cells: []int{8, 9, 0, 1}}},
+		{-1, 2, 10, false, Window{Cells: []int{9, 0}}},
+		{0, 5, 3, false, Window{Cells: []int{0, 1, 2}}},
+		{0, 4, 10, true, Window{Cells: []int{0, 1, 2, 3}, Voices: []int{1, 2, 3, 1}}},
+	}
+	for _, test := range tests {
+		got := ContiguousWindow(test.start, test.width, test.numCells, test.routed, 3)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ContiguousWindow(%d, %d, %d, %v, 3) = %v, want %v", test.start, test.width, test.numCells, test.routed, got, test.want)
+		}
+	}
+}
+
+func TestWindowGenerations(t *testing.T) {
+	generations := [][]int{{1, 1, 1}, {0, 2, 1}}
+	if got := (Window{}).Generations(generations); !reflect.DeepEqual(got, generations) {
+		t.Errorf("empty window: got %v", got)
+	}
+	want := [][]int{{0, 1, 0}, {0, 2, 0}}
+	if got := (Window{Cells: []int{1}}).Generations(generations); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -19,46 +19,119 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/loig/grac/assets"
+	"github.com/loig/grac/midi"
+	"github.com/loig/grac/sound"
 
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
 )
 
+const defaultSoundDir = "grac-sounds"
+
+// playerLatency is the time it takes to an audio player to play the
+// samples it reads, ebiten buffering 8192 bytes of them on desktops.
+const playerLatency = 8192 * time.Second / (4 * 44100)
+
 type soundManager struct {
 	context  *audio.Context
 	soundset int
 	use      bool
-	players  []*audio.Player
 	test     *audio.Player
+	// scheduler plays the steps of the automaton through player
+	scheduler *sound.Scheduler
+	player    *audio.Player
+	pitch     sound.PitchMap
+	mixer     sound.Mixer
+	accent    sound.Accent
+	scalePos  int
+	// window gives the audible cells, the contiguous ones chosen in the
+	// mixer being described by windowStart, windowWidth and windowRouted.
+	window       sound.Window
+	windowStart  int
+	windowWidth  int
+	windowRouted bool
+	// cellSounds are the sounds of each cell for cellSoundSet, computed
+	// when needed.
+	cellSounds   [][][]byte
+	cellSoundSet int
+	// midiOut plays the steps on an external synthesizer, if not nil,
+	// with the channel and note of each state given by stateNotes.
+	midiOut    *midi.Port
+	stateNotes []midi.StateNote
+	// leader sends the MIDI clock to midiOut, if not nil. When
+	// following, the steps follow the MIDI clock read from clockIn
+	// instead, while clockRunning.
+	leader       *midi.Leader
+	following    bool
+	clockIn      string
+	clockRunning bool
 }
 
-func (gD *GameDisplay) playSounds() {
-	if gD.audio.use {
-		for _, player := range gD.audio.players {
-			if player != nil {
-				err := player.Close()
-				if err != nil {
-					log.Panic(err)
-				}
-			}
-		}
-		gD.audio.players = make([]*audio.Player, len(gD.automaton.grid))
-		for i := 0; i < len(gD.automaton.grid); i++ {
-			if gD.automaton.grid[i] != 0 {
-				gD.playSound(i, gD.automaton.grid[i])
-			}
+// startScheduler creates the audio stream that plays the steps of the
+// automaton.
+func (gD *GameDisplay) startScheduler() {
+	gD.audio.scheduler = sound.NewScheduler(gD.nextStep, playerLatency)
+	player, err := audio.NewPlayer(gD.audio.context, gD.audio.scheduler)
+	if err != nil {
+		log.Panic(err)
+	}
+	gD.audio.player = player
+	gD.audio.player.Play()
+}
+
+// startSteps plays the automaton from its current generation, which is
+// played immediately.
+func (gD *GameDisplay) startSteps() {
+	if gD.audio.following {
+		// the steps start with the next step of the MIDI clock
+		return
+	}
+	gD.audio.scheduler.Start(gD.tempo)
+	if gD.audio.leader != nil {
+		if err := gD.audio.leader.Start(); err != nil {
+			gD.showMessage(fmt.Sprint("Erreur MIDI : ", err))
 		}
 	}
 }
 
-func (gD *GameDisplay) playSound(playerpos, soundpos int) {
-	soundBytes := sounds[gD.audio.soundset][soundpos-1]
-	gD.audio.players[playerpos] = audio.NewPlayerFromBytes(gD.audio.context, soundBytes)
-	gD.audio.players[playerpos].Play()
+// nextStep is called by the scheduler at the start of each step, which
+// is heard at t. It computes the next generation, except for the first
+// step, and returns the sounds of its cells.
+func (gD *GameDisplay) nextStep(step int, t sound.StepTime) []sound.Hit {
+	gD.mutex.Lock()
+	defer gD.mutex.Unlock()
+	if gD.state < stateRunAutomaton {
+		return nil
+	}
+	if step > 0 {
+		gD.automaton.Update()
+	}
+	if gD.audio.leader != nil {
+		gD.audio.leader.Step(t.Beat, t.Length)
+		if err := gD.audio.leader.Err(); err != nil {
+			gD.showMessage(fmt.Sprint("Erreur MIDI : ", err, ", horloge arrêtée"))
+		}
+	}
+	gD.sendGeneration(t.At)
+	grid := gD.audio.window.Grid(gD.automaton.Grid())
+	velocities := gD.stepVelocities(step)
+	gD.sendMIDI(grid, velocities, t.At)
+	if !gD.audio.use {
+		return nil
+	}
+	return sound.StepHits(grid, gD.cellSounds(), gD.audio.mixer, velocities)
 }
 
 func (gD *GameDisplay) initSound() {
@@ -67,21 +140,43 @@ func (gD *GameDisplay) initSound() {
 	player.Play()
 }
 
-func initAudio() soundManager {
+// initAudio decodes the built-in sound sets, followed by the set
+// synthesized from voices and by the sound sets found in soundDir, if it
+// exists. Sounds that cannot be decoded are left silent.
+func initAudio(soundDir string, voices []sound.Voice) soundManager {
 	context := audio.NewContext(44100)
 
-	theSounds := [][][]byte{
-		[][]byte{assets.Natural0, assets.Natural1, assets.Natural2, assets.Natural3},
-		[][]byte{assets.Sound0, assets.Sound1, assets.Sound2, assets.Sound3},
+	// built-in sounds have no name and are decoded as MP3
+	theSounds := make([]sound.SoundSet, len(assets.SoundSets))
+	for k, set := range assets.SoundSets {
+		for _, data := range set {
+			theSounds[k].Files = append(theSounds[k].Files, sound.File{Data: data})
+		}
+	}
+	// the synthesized set has no file to decode
+	theSounds = append(theSounds, sound.SoundSet{})
+	userSounds, err := sound.ReadSoundSets(soundDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Print(err)
 	}
+	theSounds = append(theSounds, userSounds...)
 
-	for k := 0; k < numSoundSet; k++ {
-		for i := 0; i < len(sounds[0]); i++ {
-			sound, error := mp3.Decode(context, bytes.NewReader(theSounds[k][i]))
+	sounds = make([][globalMaxNumVal - 1][]byte, len(theSounds))
+	for k := 0; k < len(theSounds); k++ {
+		for i := 0; i < len(sounds[k]) && i < len(theSounds[k].Files); i++ {
+			file := theSounds[k].Files[i]
+			stream, error := decodeSound(context, file)
+			if error == nil {
+				sounds[k][i], error = ioutil.ReadAll(stream)
+			}
 			if error != nil {
-				log.Panic(error)
+				log.Print(fmt.Errorf("%s: %v", filepath.Join(soundDir, theSounds[k].Name, file.Name), error))
 			}
-			sounds[k][i], error = ioutil.ReadAll(sound)
+		}
+	}
+	for i, voice := range voices {
+		if i < len(sounds[len(assets.SoundSets)]) {
+			sounds[len(assets.SoundSets)][i] = voice.Synthesize()
 		}
 	}
 
@@ -89,5 +184,19 @@ func initAudio() soundManager {
 		context:  context,
 		soundset: 0,
 		use:      false,
+		pitch:    sound.PitchMap{Scale: scales[0]},
+		mixer:    sound.NewMixer(globalMaxNumVal - 1),
+	}
+}
+
+// decodeSound decodes file according to its extension.
+func decodeSound(context *audio.Context, file sound.File) (io.Reader, error) {
+	src := bytes.NewReader(file.Data)
+	switch strings.ToLower(filepath.Ext(file.Name)) {
+	case ".wav":
+		return wav.Decode(context, src)
+	case ".ogg":
+		return vorbis.Decode(context, src)
 	}
+	return mp3.Decode(context, src)
 }
@@ -0,0 +1,69 @@
+/*
+GRAC, rhythm generation using cellular automata
+Copyright (C) 2021 Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// tapTimeout is the longest interval between two taps of the same
+	// tempo
+	tapTimeout = 2 * time.Second
+	// maxTaps is the number of taps used to compute the tempo
+	maxTaps = 8
+)
+
+// typedTempo holds the digits of the tempo being typed.
+var typedTempo string
+
+// taps are the times of the last taps of the tempo.
+var taps []time.Time
+
+func clampTempo(tempo float64) float64 {
+	return math.Min(math.Max(tempo, globalMinTempo), globalMaxTempo)
+}
+
+func formatTempo(tempo float64) string {
+	return strconv.FormatFloat(tempo, 'f', -1, 64)
+}
+
+// setTempo changes the tempo, also while the automaton is playing.
+func (gD *GameDisplay) setTempo(tempo float64) {
+	gD.tempo = clampTempo(tempo)
+	gD.audio.scheduler.SetTempo(gD.tempo)
+}
+
+// tapTempo records a tap and, from the second one, sets the tempo to
+// one step per mean interval between the last taps, to a tenth.
+func (gD *GameDisplay) tapTempo() {
+	now := time.Now()
+	if len(taps) > 0 && now.Sub(taps[len(taps)-1]) > tapTimeout {
+		taps = nil
+	}
+	taps = append(taps, now)
+	if len(taps) > maxTaps {
+		taps = taps[len(taps)-maxTaps:]
+	}
+	if len(taps) >= 2 {
+		interval := now.Sub(taps[0]).Minutes() / float64(len(taps)-1)
+		gD.setTempo(math.Round(10/interval) / 10)
+	}
+}